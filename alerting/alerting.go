@@ -0,0 +1,412 @@
+// Package alerting evaluates threshold rules on the readings buoys send and
+// records each time a rule fires or clears on a buoy.
+package alerting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// Severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var (
+	ErrMissingName        = errors.New("alert rule name is required")
+	ErrUnknownField       = errors.New("unknown alert rule field, expected one of " + strings.Join(Fields(), ", "))
+	ErrUnknownOperator    = errors.New("unknown alert rule operator, expected >, >=, < or <=")
+	ErrUnknownSeverity    = errors.New("unknown alert rule severity, expected info, warning or critical")
+	ErrInvalidCount       = errors.New("alert rule consecutive readings must be at least 1")
+	ErrNegativeHysteresis = errors.New("alert rule hysteresis must not be negative")
+)
+
+var operators = map[string]func(value, threshold float64) bool{
+	">":  func(value, threshold float64) bool { return value > threshold },
+	">=": func(value, threshold float64) bool { return value >= threshold },
+	"<":  func(value, threshold float64) bool { return value < threshold },
+	"<=": func(value, threshold float64) bool { return value <= threshold },
+}
+
+// Waves readings and telemetry records values rules can watch. Values a
+// buoy did not report are nil.
+var (
+	wavesFields = map[string]func(models.WavesData) *float64{
+		"significantWaveHeight": func(w models.WavesData) *float64 { return &w.SignificantWaveHeight },
+		"peakPeriod":            func(w models.WavesData) *float64 { return w.PeakPeriod },
+		"meanPeriod":            func(w models.WavesData) *float64 { return w.MeanPeriod },
+		"peakDirection":         func(w models.WavesData) *float64 { return w.PeakDirection },
+		"peakDirectionalSpread": func(w models.WavesData) *float64 { return w.PeakDirectionalSpread },
+		"meanDirection":         func(w models.WavesData) *float64 { return w.MeanDirection },
+		"meanDirectionalSpread": func(w models.WavesData) *float64 { return w.MeanDirectionalSpread },
+		"maxWaveHeight":         func(w models.WavesData) *float64 { return w.MaxWaveHeight },
+	}
+	telemetryFields = map[string]func(models.TelemetryRecord) *float64{
+		"batteryVoltage": func(r models.TelemetryRecord) *float64 { return r.BatteryVoltage },
+		"batteryPower":   func(r models.TelemetryRecord) *float64 { return r.BatteryPower },
+		"solarVoltage":   func(r models.TelemetryRecord) *float64 { return r.SolarVoltage },
+		"humidity":       func(r models.TelemetryRecord) *float64 { return r.Humidity },
+	}
+)
+
+// Fields lists the reading fields rules can watch
+func Fields() []string {
+	var fields []string
+	for name := range wavesFields {
+		fields = append(fields, name)
+	}
+	for name := range telemetryFields {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// CheckRule validates a rule, defaulting Consecutive to 1 and Severity to
+// warning
+func CheckRule(rule *models.AlertRule) error {
+	if rule.Consecutive == 0 {
+		rule.Consecutive = 1
+	}
+	if rule.Severity == "" {
+		rule.Severity = SeverityWarning
+	}
+
+	_, waves := wavesFields[rule.Field]
+	_, telemetry := telemetryFields[rule.Field]
+	switch {
+	case strings.TrimSpace(rule.Name) == "":
+		return ErrMissingName
+	case !waves && !telemetry:
+		return ErrUnknownField
+	case operators[rule.Operator] == nil:
+		return ErrUnknownOperator
+	case rule.Severity != SeverityInfo && rule.Severity != SeverityWarning && rule.Severity != SeverityCritical:
+		return ErrUnknownSeverity
+	case rule.Consecutive < 1:
+		return ErrInvalidCount
+	case rule.Hysteresis < 0:
+		return ErrNegativeHysteresis
+	}
+	return nil
+}
+
+// A reading of a buoy, with the value of each field it has
+type reading struct {
+	timestamp time.Time
+	values    map[string]float64
+	synthetic bool
+}
+
+func wavesReadings(waves []models.WavesData) []reading {
+	readings := make([]reading, len(waves))
+	for i, w := range waves {
+		values := make(map[string]float64, len(wavesFields))
+		for name, value := range wavesFields {
+			if v := value(w); v != nil {
+				values[name] = *v
+			}
+		}
+		readings[i] = reading{timestamp: w.Timestamp.Time, values: values, synthetic: w.Synthetic}
+	}
+	return readings
+}
+
+func telemetryReadings(records []models.TelemetryRecord) []reading {
+	readings := make([]reading, len(records))
+	for i, r := range records {
+		values := map[string]float64{}
+		for name, value := range telemetryFields {
+			if v := value(r); v != nil {
+				values[name] = *v
+			}
+		}
+		readings[i] = reading{timestamp: r.Timestamp.Time, values: values}
+	}
+	return readings
+}
+
+type stateKey struct {
+	rule, buoy primitive.ObjectID
+}
+
+// Where a rule stands on a buoy
+type ruleState struct {
+	firing bool
+	// Consecutive readings past the threshold while not firing
+	count int
+	// Time of the last reading evaluated
+	last time.Time
+}
+
+// Engine evaluates the rules on each new reading. It keeps the rules in
+// memory, along with the state of each rule on each buoy. After a restart a
+// rule's state is taken from its latest alert, and the count of
+// consecutive readings starts over.
+type Engine struct {
+	alerts storage.AlertStore
+
+	mu     sync.Mutex
+	rules  map[primitive.ObjectID]models.AlertRule
+	states map[stateKey]*ruleState
+	// The readings of a buoy are evaluated one batch at a time, and those of
+	// different buoys at the same time
+	buoyLocks map[primitive.ObjectID]*sync.Mutex
+}
+
+func NewEngine(alerts storage.AlertStore) *Engine {
+	return &Engine{
+		alerts:    alerts,
+		rules:     make(map[primitive.ObjectID]models.AlertRule),
+		states:    make(map[stateKey]*ruleState),
+		buoyLocks: make(map[primitive.ObjectID]*sync.Mutex),
+	}
+}
+
+// Load reads the stored rules
+func (e *Engine) Load(ctx context.Context) error {
+	rules, err := e.alerts.ListRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range rules {
+		e.rules[rule.ID] = rule
+	}
+	return nil
+}
+
+// Put adds or replaces a rule. A replaced rule's consecutive counts start
+// over.
+func (e *Engine) Put(rule models.AlertRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules[rule.ID] = rule
+	e.forget(rule.ID)
+}
+
+// Remove stops evaluating a rule
+func (e *Engine) Remove(id primitive.ObjectID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.rules, id)
+	e.forget(id)
+}
+
+// Must be called with the engine locked
+func (e *Engine) forget(ruleID primitive.ObjectID) {
+	for key := range e.states {
+		if key.rule == ruleID {
+			delete(e.states, key)
+		}
+	}
+}
+
+// Whether a rule watches a buoy
+func applies(rule models.AlertRule, buoy models.Buoy) bool {
+	if len(rule.BuoyIDs) == 0 && rule.Group == "" {
+		return true
+	}
+	for _, id := range rule.BuoyIDs {
+		if id == buoy.ID {
+			return true
+		}
+	}
+	for _, group := range buoy.Groups {
+		if rule.Group != "" && group == rule.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// The lock of a buoy's evaluations
+func (e *Engine) buoyLock(buoyID primitive.ObjectID) *sync.Mutex {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lock, ok := e.buoyLocks[buoyID]
+	if !ok {
+		lock = &sync.Mutex{}
+		e.buoyLocks[buoyID] = lock
+	}
+	return lock
+}
+
+// The state of a rule on a buoy, taken from its latest alert the first time.
+// Must be called with the buoy locked; the engine is only locked to look
+// the state up and keep it.
+func (e *Engine) state(ctx context.Context, ruleID, buoyID primitive.ObjectID) (*ruleState, error) {
+	key := stateKey{rule: ruleID, buoy: buoyID}
+	e.mu.Lock()
+	st, ok := e.states[key]
+	e.mu.Unlock()
+	if ok {
+		return st, nil
+	}
+
+	st = &ruleState{}
+	latest, err := e.alerts.LatestAlert(ctx, ruleID, buoyID)
+	switch {
+	case err == nil:
+		st.firing = latest.State == models.AlertFiring
+		st.last = latest.Timestamp.Time
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+	e.mu.Lock()
+	e.states[key] = st
+	e.mu.Unlock()
+	return st, nil
+}
+
+// Evaluate the rules watching a buoy on its new readings, in time order.
+// Readings older than the last one a rule evaluated, such as a late
+// backfill, are skipped so they cannot flip an alert.
+func (e *Engine) evaluate(ctx context.Context, buoys storage.BuoyStore, buoyID primitive.ObjectID, readings []reading) error {
+	e.mu.Lock()
+	rules := make([]models.AlertRule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		rules = append(rules, rule)
+	}
+	e.mu.Unlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	buoy, err := buoys.GetBuoy(ctx, buoyID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(readings, func(i, j int) bool { return readings[i].timestamp.Before(readings[j].timestamp) })
+
+	// The states of the buoy's rules are only changed under its lock, so
+	// storing an alert holds up the buoy's next readings and no others
+	lock := e.buoyLock(buoyID)
+	lock.Lock()
+	defer lock.Unlock()
+	for _, rule := range rules {
+		if rule.Disabled || !applies(rule, buoy) {
+			continue
+		}
+		compare := operators[rule.Operator]
+		// Past the threshold by the hysteresis, on the side of the alert
+		clearAt := rule.Threshold - rule.Hysteresis
+		if rule.Operator == "<" || rule.Operator == "<=" {
+			clearAt = rule.Threshold + rule.Hysteresis
+		}
+
+		for _, r := range readings {
+			value, ok := r.values[rule.Field]
+			if !ok {
+				continue
+			}
+			st, err := e.state(ctx, rule.ID, buoyID)
+			if err != nil {
+				return err
+			}
+			if !r.timestamp.After(st.last) {
+				continue
+			}
+
+			count := 0
+			if !st.firing && compare(value, rule.Threshold) {
+				count = st.count + 1
+			}
+			state := ""
+			switch {
+			case !st.firing && count >= rule.Consecutive:
+				state = models.AlertFiring
+			case st.firing && !compare(value, clearAt):
+				state = models.AlertCleared
+			}
+
+			if state != "" {
+				_, err := e.alerts.AddAlert(ctx, models.Alert{
+					RuleID:    rule.ID,
+					RuleName:  rule.Name,
+					BuoyID:    buoyID,
+					Severity:  rule.Severity,
+					State:     state,
+					Field:     rule.Field,
+					Value:     value,
+					Threshold: rule.Threshold,
+					Timestamp: models.NewTimestamp(r.timestamp),
+					CreatedAt: models.NewTimestamp(time.Now()),
+					Exercise:  r.synthetic,
+				})
+				// The state is left as it was, so the reading is
+				// evaluated again if it is sent again
+				if err != nil {
+					return err
+				}
+				st.firing = state == models.AlertFiring
+				count = 0
+			}
+			st.count = count
+			st.last = r.timestamp
+		}
+	}
+	return nil
+}
+
+// Store wraps a BuoyStore so that rules are evaluated on the waves readings
+// and telemetry records it stores
+func (e *Engine) Store(buoys storage.BuoyStore) storage.BuoyStore {
+	return &evaluatingStore{BuoyStore: buoys, engine: e}
+}
+
+type evaluatingStore struct {
+	storage.BuoyStore
+	engine *Engine
+}
+
+func (s *evaluatingStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddWaves(ctx, id, waves...)
+	if err != nil {
+		return duplicate, err
+	}
+	var stored []models.WavesData
+	for i, w := range waves {
+		if !duplicate[i] {
+			stored = append(stored, w)
+		}
+	}
+	if len(stored) > 0 {
+		if err := s.engine.evaluate(ctx, s.BuoyStore, id, wavesReadings(stored)); err != nil {
+			log.Println("alerting: failed to evaluate rules on waves of buoy", id.Hex(), ":", err)
+		}
+	}
+	return duplicate, nil
+}
+
+func (s *evaluatingStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddTelemetry(ctx, id, records...)
+	if err != nil {
+		return duplicate, err
+	}
+	var stored []models.TelemetryRecord
+	for i, r := range records {
+		if !duplicate[i] {
+			stored = append(stored, r)
+		}
+	}
+	if len(stored) > 0 {
+		if err := s.engine.evaluate(ctx, s.BuoyStore, id, telemetryReadings(stored)); err != nil {
+			log.Println("alerting: failed to evaluate rules on telemetry of buoy", id.Hex(), ":", err)
+		}
+	}
+	return duplicate, nil
+}
@@ -13,4 +13,11 @@ func EnvMongoURI() string {
     }
 
     return os.Getenv("MONGOURI")
-}
\ No newline at end of file
+}
+
+// MQTT broker credentials, from MQTT_USERNAME and MQTT_PASSWORD in the
+// environment or the .env file. Both are optional.
+func EnvMQTTCredentials() (string, string) {
+    godotenv.Load()
+    return os.Getenv("MQTT_USERNAME"), os.Getenv("MQTT_PASSWORD")
+}
@@ -15,7 +15,8 @@ func ConnectDB() *mongo.Client  {
         log.Fatal(err)
     }
 
-    ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
     err = client.Connect(ctx)
     if err != nil {
         log.Fatal(err)
@@ -30,9 +31,6 @@ func ConnectDB() *mongo.Client  {
     return client
 }
 
-//Client instance
-var DB *mongo.Client = ConnectDB()
-
 //getting database collections
 func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
     collection := client.Database("golangAPI").Collection(collectionName)
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/alerting"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Decode and check the alert rule of a request. It writes the error
+// response and returns false if the rule is invalid.
+func bindAlertRule(c *gin.Context, rule *models.AlertRule) bool {
+	if err := c.BindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request",
+			Data:    nil,
+		})
+		return false
+	}
+	if err := alerting.CheckRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return false
+	}
+	return true
+}
+
+// Parse the ruleId path parameter. It writes the error response and
+// returns false if it is invalid.
+func alertRuleID(c *gin.Context) (primitive.ObjectID, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("ruleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid alert rule ID",
+			Data:    nil,
+		})
+		return objID, false
+	}
+	return objID, true
+}
+
+func CreateAlertRule(alerts storage.AlertStore, engine *alerting.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var rule models.AlertRule
+		defer cancel()
+
+		if !bindAlertRule(c, &rule) {
+			return
+		}
+
+		id, err := alerts.CreateRule(ctx, rule)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create alert rule",
+				Data:    nil,
+			})
+			return
+		}
+		rule.ID = id
+		engine.Put(rule)
+
+		c.JSON(http.StatusCreated, responses.Response{
+			Status:  http.StatusCreated,
+			Message: "Alert rule created",
+			Data:    map[string]interface{}{"rule": rule},
+		})
+	}
+}
+
+func GetAlertRules(alerts storage.AlertStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rules, err := alerts.ListRules(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get alert rules",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Alert rules found",
+			Data:    map[string]interface{}{"rules": rules},
+		})
+	}
+}
+
+func GetAlertRule(alerts storage.AlertStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objID, ok := alertRuleID(c)
+		if !ok {
+			return
+		}
+
+		rule, err := alerts.GetRule(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.Response{
+				Status:  http.StatusNotFound,
+				Message: "Alert rule not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get alert rule",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Alert rule found",
+			Data:    map[string]interface{}{"rule": rule},
+		})
+	}
+}
+
+// EditAlertRule replaces a rule. The counts of consecutive readings start
+// over; whether the rule is firing on each buoy is kept.
+func EditAlertRule(alerts storage.AlertStore, engine *alerting.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var rule models.AlertRule
+		defer cancel()
+
+		objID, ok := alertRuleID(c)
+		if !ok {
+			return
+		}
+		if !bindAlertRule(c, &rule) {
+			return
+		}
+
+		rule, err := alerts.UpdateRule(ctx, objID, rule)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.Response{
+				Status:  http.StatusNotFound,
+				Message: "Alert rule not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to update alert rule",
+				Data:    nil,
+			})
+			return
+		}
+		engine.Put(rule)
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Alert rule updated",
+			Data:    map[string]interface{}{"rule": rule},
+		})
+	}
+}
+
+// DeleteAlertRule deletes a rule. The alerts it raised are kept.
+func DeleteAlertRule(alerts storage.AlertStore, engine *alerting.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objID, ok := alertRuleID(c)
+		if !ok {
+			return
+		}
+
+		err := alerts.DeleteRule(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.Response{
+				Status:  http.StatusNotFound,
+				Message: "Alert rule not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to delete alert rule",
+				Data:    nil,
+			})
+			return
+		}
+		engine.Remove(objID)
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Alert rule deleted",
+			Data:    nil,
+		})
+	}
+}
+
+// GetAlerts lists the alerts raised, by the time of the reading that raised
+// or cleared them, optionally of one buoy, rule or state
+func GetAlerts(alerts storage.AlertStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		var filter storage.AlertFilter
+		for name, id := range map[string]*primitive.ObjectID{"buoyId": &filter.BuoyID, "ruleId": &filter.RuleID} {
+			if value := c.Query(name); value != "" {
+				if *id, err = primitive.ObjectIDFromHex(value); err != nil {
+					c.JSON(http.StatusBadRequest, responses.Response{
+						Status:  http.StatusBadRequest,
+						Message: "Invalid " + name,
+						Data:    nil,
+					})
+					return
+				}
+			}
+		}
+		filter.State = c.Query("state")
+		if filter.State != "" && filter.State != models.AlertFiring && filter.State != models.AlertCleared {
+			c.JSON(http.StatusBadRequest, responses.Response{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid state, expected firing or cleared",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra alert to know whether another page follows
+		query.Limit = limit + 1
+		records, err := alerts.QueryAlerts(ctx, filter, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get alerts",
+				Data:    nil,
+			})
+			return
+		}
+
+		records, nextCursor := nextPage(records, limit, func(a models.Alert) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: a.Timestamp.Time, ID: a.ID}
+		})
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Alerts found",
+			Data:    map[string]interface{}{"alerts": records, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -2,23 +2,44 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
-	"math/rand"
 	// "fmt"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"od-api/configs"
 	"od-api/models"
+	"od-api/payloads"
 	"od-api/responses"
+	"od-api/storage"
 )
 
-var buoyCollection *mongo.Collection = configs.GetCollection(configs.DB, "buoys")
+var (
+	ErrNegativeReportInterval = errors.New("reportInterval must not be negative")
+	ErrInvalidAnchor          = errors.New("anchor must be a GeoJSON Point with a longitude and latitude in range")
+	ErrNegativeWatchRadius    = errors.New("watchRadius must not be negative")
+)
+
+// Check the monitoring settings of a buoy
+func checkBuoySettings(buoy models.Buoy) error {
+	if buoy.ReportInterval < 0 {
+		return ErrNegativeReportInterval
+	}
+	if anchor := buoy.Anchor; anchor != nil {
+		if anchor.Type != "Point" || len(anchor.Coordinates) != 2 ||
+			anchor.Coordinates[0] < MinLongitude || anchor.Coordinates[0] > MaxLongitude ||
+			anchor.Coordinates[1] < MinLatitude || anchor.Coordinates[1] > MaxLatitude {
+			return ErrInvalidAnchor
+		}
+	}
+	if buoy.WatchRadius < 0 {
+		return ErrNegativeWatchRadius
+	}
+	return nil
+}
 
-func CreateBuoy() gin.HandlerFunc {
+func CreateBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var buoy models.Buoy
@@ -29,22 +50,55 @@ func CreateBuoy() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
 		}
+		for _, w := range buoy.Waves {
+			if err := validateWavesData(w); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := payloads.CheckNames(buoy.Payloads); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkBuoySettings(buoy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The last known position is maintained from the buoy's waves data,
+		// the battery, solar and humidity values from its telemetry, and the
+		// last report time from all of its readings
+		buoy.Position, buoy.PositionTime = nil, nil
+		buoy.BatteryVoltage, buoy.BatteryPower, buoy.SolarVoltage, buoy.Humidity = 0, 0, 0, 0
+		buoy.TelemetryTime = nil
+		buoy.LastReportTime = nil
 
-		// Insert the buoy into the database using the provided MongoDB collection
-		result, err := buoyCollection.InsertOne(ctx, buoy)
+		// Insert the buoy into the store
+		buoyID, err := buoys.CreateBuoy(ctx, buoy)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create buoy"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"message": "Buoy created successfully", "data": result.InsertedID})
+		// Any initial waves data is stored as readings, not in the buoy itself.
+		// A buoy whose readings cannot be stored is removed again, so a failed
+		// request leaves nothing behind.
+		if _, err := buoys.AddWaves(ctx, buoyID, buoy.Waves...); err != nil {
+			if err := buoys.DeleteBuoy(ctx, buoyID); err != nil {
+				c.Error(err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add waves data to buoy"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Buoy created successfully", "data": buoyID})
 
 		// Start a Goroutine to periodically post waves data for this buoy
 		// go postWavesDataPeriodically(ctx, buoy)
 	}
 }
 
-func GetABuoy() gin.HandlerFunc {
+func GetABuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		buoyID := c.Param("buoyId")
@@ -60,8 +114,7 @@ func GetABuoy() gin.HandlerFunc {
 			return
 		}
 
-		var buoy models.Buoy
-		err = buoyCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&buoy)
+		buoy, err := buoys.GetBuoy(ctx, objID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, responses.BuoyResponse{
 				Status:  http.StatusNotFound,
@@ -71,6 +124,16 @@ func GetABuoy() gin.HandlerFunc {
 			return
 		}
 
+		buoy.Waves, err = buoys.RecentWaves(ctx, objID, recentWavesLimit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get waves data",
+				Data:    nil,
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, responses.BuoyResponse{
 			Status:  http.StatusOK,
 			Message: "Buoy found",
@@ -79,7 +142,7 @@ func GetABuoy() gin.HandlerFunc {
 	}
 }
 
-func EditBuoy() gin.HandlerFunc {
+func EditBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		buoyID := c.Param("buoyId")
@@ -105,21 +168,33 @@ func EditBuoy() gin.HandlerFunc {
 			})
 			return
 		}
-
-		// Update the buoy in the database using the provided MongoDB collection
-		update := bson.M{
-			"buoyname":       buoy.BuoyName,
-			"location":       buoy.Location,
-			"payloadType":    buoy.PayloadType,
-			"batteryVoltage": buoy.BatteryVoltage,
-			"batteryPower":   buoy.BatteryPower,
-			"solarVoltage":   buoy.SolarVoltage,
-			"humidity":       buoy.Humidity,
-			"waves":          buoy.Waves,
+		if err := payloads.CheckNames(buoy.Payloads); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+		if err := checkBuoySettings(buoy); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
 		}
 
-		result, err := buoyCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": update})
-
+		// Update the buoy in the store
+		updatedBuoy, err := buoys.UpdateBuoy(ctx, objID, buoy)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
 				Status:  http.StatusInternalServerError,
@@ -130,17 +205,14 @@ func EditBuoy() gin.HandlerFunc {
 		}
 
 		// Get updated buoy details
-		var updatedBuoy models.Buoy
-		if result.MatchedCount == 1 {
-			err := buoyCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&updatedBuoy)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
-					Status:  http.StatusInternalServerError,
-					Message: "Failed to get updated buoy details",
-					Data:    nil,
-				})
-				return
-			}
+		updatedBuoy.Waves, err = buoys.RecentWaves(ctx, objID, recentWavesLimit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get updated buoy details",
+				Data:    nil,
+			})
+			return
 		}
 
 		c.JSON(http.StatusOK, responses.BuoyResponse{
@@ -151,7 +223,7 @@ func EditBuoy() gin.HandlerFunc {
 	}
 }
 
-func DeleteBuoy() gin.HandlerFunc {
+func DeleteBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		buoyID := c.Param("buoyId")
@@ -167,21 +239,20 @@ func DeleteBuoy() gin.HandlerFunc {
 			return
 		}
 
-		result, err := buoyCollection.DeleteOne(ctx, bson.M{"_id": objID})
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
-				Status:  http.StatusInternalServerError,
-				Message: "Failed to delete buoy",
+		// Removes the buoy's waves data along with it
+		err = buoys.DeleteBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy with specified ID not found!",
 				Data:    nil,
 			})
 			return
 		}
-
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.BuoyResponse{
-				Status:  http.StatusNotFound,
-				Message: "Buoy with specified ID not found!",
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to delete buoy",
 				Data:    nil,
 			})
 			return
@@ -195,14 +266,12 @@ func DeleteBuoy() gin.HandlerFunc {
 	}
 }
 
-func GetAllBuoys() gin.HandlerFunc {
+func GetAllBuoys(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		var buoys []models.Buoy
 		defer cancel()
 
-		results, err := buoyCollection.Find(ctx, bson.M{})
-
+		allBuoys, err := buoys.ListBuoys(ctx)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
 				Status:  http.StatusInternalServerError,
@@ -212,30 +281,27 @@ func GetAllBuoys() gin.HandlerFunc {
 			return
 		}
 
-		// Read from the db in an optimal way
-		defer results.Close(ctx)
-		for results.Next(ctx) {
-			var singleBuoy models.Buoy
-			if err = results.Decode(&singleBuoy); err != nil {
+		for i := range allBuoys {
+			// Only the latest reading is listed; use GET /buoy/:buoyId for history
+			allBuoys[i].Waves, err = buoys.RecentWaves(ctx, allBuoys[i].ID, 1)
+			if err != nil {
 				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
 					Status:  http.StatusInternalServerError,
-					Message: "Failed to decode buoy data",
+					Message: "Failed to get waves data",
 					Data:    nil,
 				})
 				return
 			}
-
-			buoys = append(buoys, singleBuoy)
 		}
 
 		c.JSON(http.StatusOK, responses.BuoyResponse{
 			Status:  http.StatusOK,
 			Message: "Buoys found",
-			Data:    map[string]interface{}{"buoys": buoys},
+			Data:    map[string]interface{}{"buoys": allBuoys},
 		})
 	}
 }
-func AddWavesDataToBuoy() gin.HandlerFunc {
+func AddWavesDataToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		buoyID := c.Param("buoyId")
@@ -253,25 +319,26 @@ func AddWavesDataToBuoy() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
 		}
+		if err := validateWavesData(wavesData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Find the buoy with the specified ID
-		var buoy models.Buoy
-		err = buoyCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&buoy)
-		if err != nil {
+		// Store the new waves data as its own reading. Retries of a reading
+		// that was already stored succeed without adding it again.
+		duplicate, err := buoys.AddWaves(ctx, objID, wavesData)
+		if errors.Is(err, storage.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Buoy not found"})
 			return
 		}
-
-		// Append the new waves data to the buoy's Waves slice
-		buoy.Waves = append(buoy.Waves, wavesData)
-
-		// Update the buoy in the database with the new waves data
-		update := bson.M{"$set": bson.M{"waves": buoy.Waves}}
-		_, err = buoyCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add waves data to buoy"})
 			return
 		}
+		if duplicate[0] {
+			c.JSON(http.StatusOK, gin.H{"message": "Waves data already recorded for this timestamp"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Waves data added to buoy successfully"})
 	}
@@ -285,76 +352,9 @@ const (
 	MinLongitude = -180.0
 	MaxLongitude = 180.0
 )
-// Generate realistic latitude and longitude for the buoy's location
-func generateRandomLocation(initialLatitude, initialLongitude float64) (float64, float64) {
-	// Calculate random deviation from the initial latitude and longitude
-	latitudeDeviation := rand.Float64() * 0.01
-	longitudeDeviation := rand.Float64() * 0.01
-
-	// Calculate the new latitude and longitude by adding the deviation to the initial coordinates
-	latitude := initialLatitude + latitudeDeviation
-	longitude := initialLongitude + longitudeDeviation
-
-	// Clamp latitude and longitude to the valid range
-	if latitude < MinLatitude {
-		latitude = MinLatitude
-	} else if latitude > MaxLatitude {
-		latitude = MaxLatitude
-	}
-	if longitude < MinLongitude {
-		longitude = MinLongitude
-	} else if longitude > MaxLongitude {
-		longitude = MaxLongitude
-	}
-
-	return latitude, longitude
-}
-
-// Generate realistic wave data
-func generateRandomWavesData(initialLatitude, initialLongitude float64) models.WavesData {
-	// Generate random wave height (between 0.5 and 5 meters)
-	significantWaveHeight := rand.Float64()*4.5 + 0.5
 
-	// Generate random wave period (between 4 and 15 seconds)
-	peakPeriod := rand.Float64()*11.0 + 4.0
-
-	// Generate random wave direction (between 0 and 360 degrees)
-	peakDirection := rand.Float64() * 360.0
-
-	// Generate random timestamp within the last 24 hours
-	timestamp := time.Now().Add(-time.Duration(rand.Intn(24))*time.Hour).UTC().Format(time.RFC3339)
-
-	// Generate random latitude and longitude for the buoy's location
-	latitude, longitude := generateRandomLocation(initialLatitude, initialLongitude)
-
-	// Calculate random direction for the waves (deviation from peakDirection)
-	peakDirectionalSpread := rand.Float64()*30.0 + 5.0
-
-	// Calculate mean direction (opposite to peakDirection)
-	meanDirection := peakDirection + 180.0
-	if meanDirection > 360.0 {
-		meanDirection -= 360.0
-	}
-
-	// Calculate random spread for the mean direction
-	meanDirectionalSpread := rand.Float64()*60.0 + 15.0
-
-	return models.WavesData{
-		SignificantWaveHeight:   significantWaveHeight,
-		PeakPeriod:              peakPeriod,
-		MeanPeriod:              peakPeriod * 0.9,
-		PeakDirection:           peakDirection,
-		PeakDirectionalSpread:   peakDirectionalSpread,
-		MeanDirection:           meanDirection,
-		MeanDirectionalSpread:   meanDirectionalSpread,
-		Timestamp:               timestamp,
-		Latitude:                latitude,
-		Longitude:               longitude,
-	}
-}
-
-// Insert wave data into the database for a specific buoy ID
-func InsertWaveDataForBuoy(buoyID string, waveData models.WavesData) error {
+// Insert wave data into the store for a specific buoy ID
+func InsertWaveDataForBuoy(buoys storage.BuoyStore, buoyID string, waveData models.WavesData) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -363,18 +363,16 @@ func InsertWaveDataForBuoy(buoyID string, waveData models.WavesData) error {
 		return err
 	}
 
-	filter := bson.M{"_id": objID}
-	update := bson.M{"$push": bson.M{"waves": waveData}}
-
-	_, err = buoyCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
+	if err := validateWavesData(waveData); err != nil {
 		return err
 	}
 
-	return nil
+	// A reading already stored for this timestamp is not added again
+	_, err = buoys.AddWaves(ctx, objID, waveData)
+	return err
 }
 
-func CreateWaveDataForBuoy() gin.HandlerFunc {
+func CreateWaveDataForBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var data models.WavesData
 
@@ -392,7 +390,7 @@ func CreateWaveDataForBuoy() gin.HandlerFunc {
 		buoyID := "64c1de1bccc77c103ab51ed1" // Replace this with the actual buoy ID from the request
 
 		// Insert the wave data for the specified buoy ID
-		if err := InsertWaveDataForBuoy(buoyID, data); err != nil {
+		if err := InsertWaveDataForBuoy(buoys, buoyID, data); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.UserResponse{
 				Status:  http.StatusInternalServerError,
 				Message: "Failed to insert wave data",
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Largest search radius of GET /buoys/near, about half the Earth's circumference
+const maxNearRadiusKm = 20000.0
+
+// Parse a required float query parameter within [min, max]
+func parseFloatParam(c *gin.Context, name string, min, max float64) (float64, bool) {
+	value, err := strconv.ParseFloat(c.Query(name), 64)
+	if err != nil || value < min || value > max {
+		return 0, false
+	}
+	return value, true
+}
+
+// Parse a minLon,minLat,maxLon,maxLat bounding box. minLon may be greater
+// than maxLon for boxes crossing the antimeridian.
+func parseBBox(value string) (storage.BBox, bool) {
+	var values [4]float64
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return storage.BBox{}, false
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return storage.BBox{}, false
+		}
+		values[i] = v
+	}
+
+	bbox := storage.BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if bbox.MinLon < MinLongitude || bbox.MinLon > MaxLongitude || bbox.MaxLon < MinLongitude || bbox.MaxLon > MaxLongitude {
+		return bbox, false
+	}
+	if bbox.MinLat < MinLatitude || bbox.MaxLat > MaxLatitude || bbox.MinLat > bbox.MaxLat {
+		return bbox, false
+	}
+	return bbox, true
+}
+
+func GetBuoysNear(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		lat, okLat := parseFloatParam(c, "lat", MinLatitude, MaxLatitude)
+		lon, okLon := parseFloatParam(c, "lon", MinLongitude, MaxLongitude)
+		if !okLat || !okLon {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid lat or lon",
+				Data:    nil,
+			})
+			return
+		}
+		radiusKm, ok := parseFloatParam(c, "radiusKm", 0, maxNearRadiusKm)
+		if !ok || radiusKm == 0 {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid radiusKm, expected a distance up to 20000",
+				Data:    nil,
+			})
+			return
+		}
+
+		nearby, err := buoys.BuoysNear(ctx, lat, lon, radiusKm)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to find buoys near location",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Buoys found",
+			Data:    map[string]interface{}{"buoys": nearby},
+		})
+	}
+}
+
+func GetBuoysWithin(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		bbox, ok := parseBBox(c.Query("bbox"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid bbox, expected minLon,minLat,maxLon,maxLat",
+				Data:    nil,
+			})
+			return
+		}
+
+		within, err := buoys.BuoysWithin(ctx, bbox)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to find buoys within bounding box",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Buoys found",
+			Data:    map[string]interface{}{"buoys": within},
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/geo"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Most fixes GET /buoy/:buoyId/track returns in one response
+const maxTrackFixes = 10000
+
+// GeoJSON objects of a track
+type (
+	trackCollection struct {
+		Type     string         `json:"type"`
+		Features []trackFeature `json:"features"`
+	}
+	trackFeature struct {
+		Type       string        `json:"type"`
+		Geometry   trackGeometry `json:"geometry"`
+		Properties interface{}   `json:"properties"`
+	}
+	trackGeometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}
+)
+
+// Properties of the LineString of a track. Distance is in meters along the
+// track.
+type trackLineProperties struct {
+	BuoyID   primitive.ObjectID `json:"buoyId"`
+	BuoyName string             `json:"buoyname,omitempty"`
+	From     models.Timestamp   `json:"from"`
+	To       models.Timestamp   `json:"to"`
+	Fixes    int                `json:"fixes"`
+	Distance float64            `json:"distance"`
+}
+
+// Properties of a fix of a track. Speed, in meters per second, and heading,
+// in degrees from true north, are over ground from the previous fix, so
+// the first fix has neither.
+type trackFixProperties struct {
+	Timestamp models.Timestamp `json:"timestamp"`
+	Speed     *float64         `json:"speed,omitempty"`
+	Heading   *float64         `json:"heading,omitempty"`
+}
+
+// Build the GeoJSON track of some fixes in time order: a LineString through
+// all of them, when there are at least two, followed by a Point for each.
+func buildTrack(buoy models.Buoy, fixes []models.WaveObservation) trackCollection {
+	track := trackCollection{Type: "FeatureCollection", Features: []trackFeature{}}
+	if len(fixes) == 0 {
+		return track
+	}
+
+	line := make([][]float64, len(fixes))
+	points := make([]trackFeature, len(fixes))
+	distance := 0.0
+	for i, fix := range fixes {
+		line[i] = []float64{fix.Longitude, fix.Latitude}
+		properties := trackFixProperties{Timestamp: fix.Timestamp}
+
+		if i > 0 {
+			prev := fixes[i-1]
+			meters := geo.DistanceKm(prev.Latitude, prev.Longitude, fix.Latitude, fix.Longitude) * 1000
+			heading := geo.BearingDegrees(prev.Latitude, prev.Longitude, fix.Latitude, fix.Longitude)
+			speed := meters / fix.Timestamp.Sub(prev.Timestamp.Time).Seconds()
+			properties.Speed, properties.Heading = &speed, &heading
+			distance += meters
+		}
+
+		points[i] = trackFeature{
+			Type:       "Feature",
+			Geometry:   trackGeometry{Type: "Point", Coordinates: line[i]},
+			Properties: properties,
+		}
+	}
+
+	if len(fixes) > 1 {
+		track.Features = append(track.Features, trackFeature{
+			Type:     "Feature",
+			Geometry: trackGeometry{Type: "LineString", Coordinates: line},
+			Properties: trackLineProperties{
+				BuoyID:   buoy.ID,
+				BuoyName: buoy.BuoyName,
+				From:     fixes[0].Timestamp,
+				To:       fixes[len(fixes)-1].Timestamp,
+				Fixes:    len(fixes),
+				Distance: distance,
+			},
+		})
+	}
+	track.Features = append(track.Features, points...)
+	return track
+}
+
+// GetBuoyTrack returns the positions of a buoy's waves readings between
+// from and to as a GeoJSON FeatureCollection, with the speed and heading
+// between consecutive fixes
+func GetBuoyTrack(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		from, to, err := parseTimeRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		var fixes []models.WaveObservation
+		if err == nil {
+			// Fetch one extra fix to know whether the range has too many
+			fixes, err = buoys.QueryWaves(ctx, objID, storage.RangeQuery{From: from, To: to, Limit: maxTrackFixes + 1})
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get track",
+				Data:    nil,
+			})
+			return
+		}
+		if len(fixes) > maxTrackFixes {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Too many fixes, use a shorter time range",
+				Data:    nil,
+			})
+			return
+		}
+
+		body, err := json.Marshal(buildTrack(buoy, fixes))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get track",
+				Data:    nil,
+			})
+			return
+		}
+		c.Data(http.StatusOK, "application/geo+json", body)
+	}
+}
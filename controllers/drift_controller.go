@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// GetDriftEvents lists the times buoys left or came back into their watch
+// circle, by the time of the fix
+func GetDriftEvents(drifts storage.DriftStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		var filter storage.DriftEventFilter
+		if value := c.Query("buoyId"); value != "" {
+			if filter.BuoyID, err = primitive.ObjectIDFromHex(value); err != nil {
+				c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid buoyId",
+					Data:    nil,
+				})
+				return
+			}
+		}
+		filter.State = c.Query("state")
+		if filter.State != "" && filter.State != models.DriftAdrift && filter.State != models.DriftReturned {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid state, expected adrift or returned",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra event to know whether another page follows
+		query.Limit = limit + 1
+		events, err := drifts.QueryDriftEvents(ctx, filter, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get drift events",
+				Data:    nil,
+			})
+			return
+		}
+
+		events, nextCursor := nextPage(events, limit, func(e models.DriftEvent) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: e.Timestamp.Time, ID: e.ID}
+		})
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Drift events found",
+			Data:    map[string]interface{}{"events": events, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/payloads"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// GetPayloadTypes lists the registered payload types and their fields
+func GetPayloadTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Payload types found",
+			Data:    map[string]interface{}{"payloads": payloads.All()},
+		})
+	}
+}
+
+// Look up the buoy and payload type of an observations request, writing the
+// error response if either is unusable
+func observationTarget(ctx context.Context, c *gin.Context, buoys storage.BuoyStore) (primitive.ObjectID, *payloads.Payload, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("buoyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid buoy ID",
+			Data:    nil,
+		})
+		return objID, nil, false
+	}
+
+	payload, ok := payloads.Lookup(c.Param("payload"))
+	if !ok {
+		c.JSON(http.StatusNotFound, responses.BuoyResponse{
+			Status:  http.StatusNotFound,
+			Message: "Unknown payload type",
+			Data:    nil,
+		})
+		return objID, nil, false
+	}
+
+	buoy, err := buoys.GetBuoy(ctx, objID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, responses.BuoyResponse{
+			Status:  http.StatusNotFound,
+			Message: "Buoy not found",
+			Data:    nil,
+		})
+		return objID, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get buoy",
+			Data:    nil,
+		})
+		return objID, nil, false
+	}
+	if !payloads.Carries(buoy, payload.Name) {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: "Buoy does not carry the " + payload.Name + " payload",
+			Data:    nil,
+		})
+		return objID, nil, false
+	}
+	return objID, payload, true
+}
+
+// AddObservationToBuoy stores a reading of one of the buoy's payloads,
+// validated against the payload type's fields
+func AddObservationToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var observation models.Observation
+		defer cancel()
+
+		objID, payload, ok := observationTarget(ctx, c, buoys)
+		if !ok {
+			return
+		}
+
+		if err := c.BindJSON(&observation); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request",
+				Data:    nil,
+			})
+			return
+		}
+		if err := payload.Validate(observation); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		duplicate, err := payload.Store(ctx, buoys, objID, observation)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add observation",
+				Data:    nil,
+			})
+			return
+		}
+		if duplicate[0] {
+			c.JSON(http.StatusOK, responses.BuoyResponse{
+				Status:  http.StatusOK,
+				Message: "Observation already recorded for this timestamp",
+				Data:    map[string]interface{}{"observation": observation},
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.BuoyResponse{
+			Status:  http.StatusCreated,
+			Message: "Observation added to buoy successfully",
+			Data:    map[string]interface{}{"observation": observation},
+		})
+	}
+}
+
+func GetBuoyObservations(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		objID, payload, ok := observationTarget(ctx, c, buoys)
+		if !ok {
+			return
+		}
+
+		// Fetch one extra reading to know whether another page follows
+		query.Limit = limit + 1
+		records, err := payload.Query(ctx, buoys, objID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get observations",
+				Data:    nil,
+			})
+			return
+		}
+
+		records, nextCursor := nextPage(records, limit, func(o models.PayloadObservation) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+		})
+
+		observations := make([]models.Observation, len(records))
+		for i, o := range records {
+			observations[i] = o.Observation
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Observations found",
+			Data:    map[string]interface{}{"observations": observations, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/payloads"
+	"od-api/responses"
+	"od-api/simulator"
+	"od-api/storage"
+)
+
+// ErrNotSimulatedBuoy is returned for a buoy not marked simulated. The
+// simulator never runs on, or stores readings for, a buoy that may also
+// report real ones.
+var ErrNotSimulatedBuoy = errors.New("buoy is not marked simulated")
+
+// Stores the readings of simulated buoys like those of real ones
+type simulatorSink struct {
+	buoys storage.BuoyStore
+}
+
+// SimulatorSink returns a sink storing the readings of simulated buoys in
+// buoys, validated as if the buoys had sent them. Readings of buoys not
+// marked simulated are refused.
+func SimulatorSink(buoys storage.BuoyStore) simulator.Sink {
+	return simulatorSink{buoys: buoys}
+}
+
+func (s simulatorSink) AddWaves(buoyID string, waves models.WavesData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(buoyID)
+	if err != nil {
+		return err
+	}
+	buoy, err := s.buoys.GetBuoy(ctx, objID)
+	if err != nil {
+		return err
+	}
+	if !buoy.Simulated {
+		return ErrNotSimulatedBuoy
+	}
+	return InsertWaveDataForBuoy(s.buoys, buoyID, waves)
+}
+
+func (s simulatorSink) AddObservation(buoyID, name string, observation models.Observation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(buoyID)
+	if err != nil {
+		return err
+	}
+	payload, ok := payloads.Lookup(name)
+	if !ok {
+		return errors.New("unknown payload type " + name)
+	}
+	buoy, err := s.buoys.GetBuoy(ctx, objID)
+	if err != nil {
+		return err
+	}
+	if !buoy.Simulated {
+		return ErrNotSimulatedBuoy
+	}
+	if !payloads.Carries(buoy, name) {
+		return errors.New("buoy does not carry the " + name + " payload")
+	}
+	if err := payload.Validate(observation); err != nil {
+		return err
+	}
+
+	// A reading already stored for this timestamp is not added again
+	_, err = payload.Store(ctx, s.buoys, objID, observation)
+	return err
+}
+
+// Decode the simulated buoy config of a request and check that its buoy
+// exists and is marked simulated. A config without an anchor takes the
+// buoy's. It writes the error
+// response and returns false if the config is invalid.
+func bindSimulatorConfig(ctx context.Context, c *gin.Context, buoys storage.BuoyStore, config *simulator.Config) bool {
+	if err := c.BindJSON(config); err != nil {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request",
+			Data:    nil,
+		})
+		return false
+	}
+	if buoyID := c.Param("buoyId"); buoyID != "" {
+		config.BuoyID = buoyID
+	}
+
+	objID, err := primitive.ObjectIDFromHex(config.BuoyID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid buoy ID",
+			Data:    nil,
+		})
+		return false
+	}
+	buoy, err := buoys.GetBuoy(ctx, objID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, responses.BuoyResponse{
+			Status:  http.StatusNotFound,
+			Message: "Buoy not found",
+			Data:    nil,
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get buoy",
+			Data:    nil,
+		})
+		return false
+	}
+	if !buoy.Simulated {
+		simulatorError(c, ErrNotSimulatedBuoy)
+		return false
+	}
+	if config.Anchor == nil {
+		config.Anchor = buoy.Anchor
+	}
+	return true
+}
+
+// Write the error response of a simulator error
+func simulatorError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, simulator.ErrNotSimulated):
+		status = http.StatusNotFound
+	case errors.Is(err, simulator.ErrSimulated), errors.Is(err, ErrNotSimulatedBuoy):
+		status = http.StatusConflict
+	case errors.Is(err, simulator.ErrShutdown):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, responses.BuoyResponse{
+		Status:  status,
+		Message: err.Error(),
+		Data:    nil,
+	})
+}
+
+func GetSimulatedBuoys(simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Simulated buoys found",
+			Data:    map[string]interface{}{"buoys": simulations.List()},
+		})
+	}
+}
+
+func GetSimulatedBuoy(simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := simulations.Get(c.Param("buoyId"))
+		if err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Simulated buoy found",
+			Data:    map[string]interface{}{"buoy": status},
+		})
+	}
+}
+
+// StartSimulatedBuoy starts simulating an existing buoy
+func StartSimulatedBuoy(buoys storage.BuoyStore, simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var config simulator.Config
+		defer cancel()
+
+		if !bindSimulatorConfig(ctx, c, buoys, &config) {
+			return
+		}
+		status, err := simulations.Start(config)
+		if err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.BuoyResponse{
+			Status:  http.StatusCreated,
+			Message: "Simulated buoy started",
+			Data:    map[string]interface{}{"buoy": status},
+		})
+	}
+}
+
+// EditSimulatedBuoy replaces the settings of a simulated buoy, which carries
+// on with the same seed
+func EditSimulatedBuoy(buoys storage.BuoyStore, simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var config simulator.Config
+		defer cancel()
+
+		if !bindSimulatorConfig(ctx, c, buoys, &config) {
+			return
+		}
+		status, err := simulations.Reconfigure(config.BuoyID, config)
+		if err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Simulated buoy updated",
+			Data:    map[string]interface{}{"buoy": status},
+		})
+	}
+}
+
+// StopSimulatedBuoy stops simulating a buoy. The buoy and its readings are
+// kept.
+func StopSimulatedBuoy(simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := simulations.Stop(c.Param("buoyId")); err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Simulated buoy stopped",
+			Data:    nil,
+		})
+	}
+}
+
+// PlayScenario plays a drill scenario, given as YAML or JSON, on an existing
+// buoy marked simulated. A scenario reporting a water level needs a buoy carrying the
+// waterlevel payload.
+func PlayScenario(buoys storage.BuoyStore, simulations *simulator.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request",
+				Data:    nil,
+			})
+			return
+		}
+		scenario, err := simulator.ParseScenario(body)
+		if err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(scenario.Buoy.BuoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get buoy",
+				Data:    nil,
+			})
+			return
+		}
+		if !buoy.Simulated {
+			simulatorError(c, ErrNotSimulatedBuoy)
+			return
+		}
+		if scenario.WaterLevel() && !payloads.Carries(buoy, simulator.WaterLevelPayload) {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Buoy does not carry the " + simulator.WaterLevelPayload + " payload the scenario reports",
+				Data:    nil,
+			})
+			return
+		}
+		if scenario.Buoy.Anchor == nil {
+			scenario.Buoy.Anchor = buoy.Anchor
+		}
+
+		status, err := simulations.Play(scenario)
+		if err != nil {
+			simulatorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.BuoyResponse{
+			Status:  http.StatusCreated,
+			Message: "Scenario started",
+			Data:    map[string]interface{}{"buoy": status},
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/spectral"
+	"od-api/storage"
+)
+
+// AddSpectrumToBuoy stores a directional wave spectrum along with the bulk
+// waves data derived from it
+func AddSpectrumToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		var spectrum models.WaveSpectrum
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		if err := c.BindJSON(&spectrum); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request",
+				Data:    nil,
+			})
+			return
+		}
+		if err := spectral.Validate(spectrum); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+		spectral.Complete(&spectrum)
+		bulk := spectral.Bulk(spectrum)
+		if err := validateWavesData(bulk); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		duplicate, err := buoys.AddSpectra(ctx, objID, spectrum)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add spectrum",
+				Data:    nil,
+			})
+			return
+		}
+
+		// The derived bulk parameters join the buoy's waves data. They are
+		// added for a duplicate spectrum too, in case storing them failed
+		// when it was first sent, and are not added twice.
+		if _, err := buoys.AddWaves(ctx, objID, bulk); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add waves data to buoy",
+				Data:    nil,
+			})
+			return
+		}
+		if duplicate[0] {
+			c.JSON(http.StatusOK, responses.BuoyResponse{
+				Status:  http.StatusOK,
+				Message: "Spectrum already recorded for this timestamp",
+				Data:    map[string]interface{}{"spectrum": spectrum, "waves": bulk},
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.BuoyResponse{
+			Status:  http.StatusCreated,
+			Message: "Spectrum added to buoy successfully",
+			Data:    map[string]interface{}{"spectrum": spectrum, "waves": bulk},
+		})
+	}
+}
+
+func GetBuoySpectra(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		if _, err := buoys.GetBuoy(ctx, objID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, responses.BuoyResponse{
+					Status:  http.StatusNotFound,
+					Message: "Buoy not found",
+					Data:    nil,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get spectra",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra spectrum to know whether another page follows
+		query.Limit = limit + 1
+		observations, err := buoys.QuerySpectra(ctx, objID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get spectra",
+				Data:    nil,
+			})
+			return
+		}
+
+		observations, nextCursor := nextPage(observations, limit, func(o models.SpectrumObservation) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+		})
+
+		spectra := make([]models.WaveSpectrum, len(observations))
+		for i, o := range observations {
+			spectra[i] = o.WaveSpectrum
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Spectra found",
+			Data:    map[string]interface{}{"spectra": spectra, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/payloads"
+	"od-api/responses"
+	"od-api/spotter"
+	"od-api/storage"
+)
+
+// Outcome of one kind of reading of a Spotter payload
+type spotterCount struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+	Rejected   int `json:"rejected"`
+}
+
+// Count stored readings by whether they were duplicates
+func (s *spotterCount) add(duplicate []bool) {
+	for _, d := range duplicate {
+		if d {
+			s.Duplicates++
+		} else {
+			s.Accepted++
+		}
+	}
+}
+
+// A reading or array of a Spotter payload that was not stored
+type spotterError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// Store the wind or surface temperature readings of a Spotter payload as
+// observations of a payload type, if the buoy carries it. Returns the
+// readings that were stored, duplicates included.
+func storeSpotterObservations(ctx context.Context, buoys storage.BuoyStore, buoy models.Buoy, name, field string, observations []models.Observation, count *spotterCount, errs *[]spotterError) ([]models.Observation, error) {
+	if len(observations) == 0 {
+		return nil, nil
+	}
+	if !payloads.Carries(buoy, name) {
+		count.Rejected += len(observations)
+		*errs = append(*errs, spotterError{Field: field, Error: "Buoy does not carry the " + name + " payload"})
+		return nil, nil
+	}
+
+	payload, _ := payloads.Lookup(name)
+	var valid []models.Observation
+	for i, o := range observations {
+		if err := payload.Validate(o); err != nil {
+			count.Rejected++
+			*errs = append(*errs, spotterError{Field: fmt.Sprintf("%s[%d]", field, i), Error: err.Error()})
+			continue
+		}
+		valid = append(valid, o)
+	}
+	if len(valid) == 0 {
+		return nil, nil
+	}
+
+	duplicate, err := payload.Store(ctx, buoys, buoy.ID, valid...)
+	if err != nil {
+		return nil, err
+	}
+	count.add(duplicate)
+	return valid, nil
+}
+
+// AddSpotterDataToBuoy ingests a payload in the Sofar Spotter API shape:
+// waves readings become waves data, wind and surfaceTemp readings become
+// wind and sst observations, and the battery, solar and humidity values a
+// telemetry record. Fields the adapter does not know are reported, not
+// stored.
+func AddSpotterDataToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBatchBytes))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, responses.BuoyResponse{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("Payload too large, the limit is %d bytes", MaxBatchBytes),
+				Data:    nil,
+			})
+			return
+		}
+		data, unknown, err := spotter.Decode(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request, expected Spotter wave data: " + err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add Spotter data to buoy",
+				Data:    nil,
+			})
+			return
+		}
+
+		errs := []spotterError{}
+		var waves, wind, surfaceTemp spotterCount
+
+		// The telemetry values have no time of their own; they are taken
+		// to be as recent as the newest reading stored
+		var latest time.Time
+		var valid []models.WavesData
+		for i, w := range data.Waves {
+			if err := validateWavesData(w); err != nil {
+				waves.Rejected++
+				errs = append(errs, spotterError{Field: fmt.Sprintf("waves[%d]", i), Error: err.Error()})
+				continue
+			}
+			valid = append(valid, w)
+		}
+		if len(valid) > 0 {
+			duplicate, err := buoys.AddWaves(ctx, objID, valid...)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+					Status:  http.StatusInternalServerError,
+					Message: "Failed to add waves data to buoy",
+					Data:    nil,
+				})
+				return
+			}
+			waves.add(duplicate)
+			for _, w := range valid {
+				if w.Timestamp.After(latest) {
+					latest = w.Timestamp.Time
+				}
+			}
+		}
+
+		windObservations := make([]models.Observation, len(data.Wind))
+		for i, w := range data.Wind {
+			windObservations[i] = models.Observation{
+				Timestamp: w.Timestamp,
+				Values:    map[string]float64{"windSpeed": w.Speed, "windDirection": w.Direction},
+			}
+		}
+		tempObservations := make([]models.Observation, len(data.SurfaceTemp))
+		for i, t := range data.SurfaceTemp {
+			tempObservations[i] = models.Observation{
+				Timestamp: t.Timestamp,
+				Values:    map[string]float64{"seaSurfaceTemperature": t.Degrees},
+			}
+		}
+		storedWind, err := storeSpotterObservations(ctx, buoys, buoy, "wind", "wind", windObservations, &wind, &errs)
+		var storedTemp []models.Observation
+		if err == nil {
+			storedTemp, err = storeSpotterObservations(ctx, buoys, buoy, "sst", "surfaceTemp", tempObservations, &surfaceTemp, &errs)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add observations to buoy",
+				Data:    nil,
+			})
+			return
+		}
+		for _, o := range append(storedWind, storedTemp...) {
+			if o.Timestamp.After(latest) {
+				latest = o.Timestamp.Time
+			}
+		}
+
+		result := map[string]interface{}{
+			"waves":         waves,
+			"wind":          wind,
+			"surfaceTemp":   surfaceTemp,
+			"unknownFields": append([]string{}, unknown...),
+		}
+
+		record := models.TelemetryRecord{
+			BatteryVoltage: data.BatteryVoltage,
+			BatteryPower:   data.BatteryPower,
+			SolarVoltage:   data.SolarVoltage,
+			Humidity:       data.Humidity,
+		}
+		if latest.IsZero() {
+			latest = time.Now()
+		}
+		record.Timestamp = models.NewTimestamp(latest)
+		switch err := validateTelemetryRecord(record); {
+		case errors.Is(err, ErrEmptyTelemetry):
+			// The payload carried no telemetry
+		case err != nil:
+			result["telemetry"] = batchRejected
+			errs = append(errs, spotterError{Field: "telemetry", Error: err.Error()})
+		default:
+			duplicate, err := buoys.AddTelemetry(ctx, objID, record)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+					Status:  http.StatusInternalServerError,
+					Message: "Failed to add telemetry",
+					Data:    nil,
+				})
+				return
+			}
+			result["telemetry"] = batchAccepted
+			if duplicate[0] {
+				result["telemetry"] = batchDuplicate
+			}
+		}
+		result["errors"] = errs
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Spotter data added to buoy",
+			Data:    result,
+		})
+	}
+}
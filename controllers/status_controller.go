@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// GetStatusEvents lists the changes of buoys' reporting status by the time
+// they were noticed
+func GetStatusEvents(statuses storage.StatusStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		var filter storage.StatusEventFilter
+		if value := c.Query("buoyId"); value != "" {
+			if filter.BuoyID, err = primitive.ObjectIDFromHex(value); err != nil {
+				c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid buoyId",
+					Data:    nil,
+				})
+				return
+			}
+		}
+		filter.Status = c.Query("status")
+		switch filter.Status {
+		case "", models.StatusOnline, models.StatusLate, models.StatusOffline:
+		default:
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid status, expected online, late or offline",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra event to know whether another page follows
+		query.Limit = limit + 1
+		events, err := statuses.QueryStatusEvents(ctx, filter, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get status events",
+				Data:    nil,
+			})
+			return
+		}
+
+		events, nextCursor := nextPage(events, limit, func(e models.StatusEvent) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: e.Timestamp.Time, ID: e.ID}
+		})
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Status events found",
+			Data:    map[string]interface{}{"events": events, "nextCursor": nextCursor},
+		})
+	}
+}
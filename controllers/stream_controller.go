@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/responses"
+	"od-api/storage"
+	"od-api/stream"
+)
+
+// Keeps idle streams from being closed by proxies
+const streamHeartbeat = 15 * time.Second
+
+// The streams are read-only and the API has no cookie sessions, so
+// dashboards served from other origins may connect
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// GetBuoyStream streams a buoy's new waves readings and telemetry records
+func GetBuoyStream(buoys storage.BuoyStore, hub *stream.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		_, err = buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to stream buoy",
+				Data:    nil,
+			})
+			return
+		}
+
+		serveStream(c, hub, objID)
+	}
+}
+
+// GetBuoysStream streams the new waves readings and telemetry records of
+// every buoy
+func GetBuoysStream(hub *stream.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveStream(c, hub, primitive.NilObjectID)
+	}
+}
+
+// Stream events over a WebSocket if the client asks for an upgrade, and as
+// Server-Sent Events otherwise. Clients resume with the Last-Event-ID header
+// or, as browsers cannot set headers on WebSockets, the lastEventId
+// parameter.
+func serveStream(c *gin.Context, hub *stream.Hub, buoyID primitive.ObjectID) {
+	var lastEventID *uint64
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid last event ID",
+				Data:    nil,
+			})
+			return
+		}
+		lastEventID = &id
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has already answered
+			return
+		}
+		defer conn.Close()
+
+		subscription, backlog := hub.Subscribe(buoyID, lastEventID)
+		defer subscription.Close()
+		streamWebSocket(conn, subscription, backlog)
+		return
+	}
+
+	subscription, backlog := hub.Subscribe(buoyID, lastEventID)
+	defer subscription.Close()
+	streamEvents(c, subscription, backlog)
+}
+
+func streamEvents(c *gin.Context, subscription *stream.Subscription, backlog []stream.Event) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	write := func(e stream.Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err
+	}
+
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	for _, e := range backlog {
+		if write(e) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-subscription.Events():
+			// Dropped for falling behind; EventSource reconnects and
+			// resumes
+			if !ok || write(e) != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func streamWebSocket(conn *websocket.Conn, subscription *stream.Subscription, backlog []stream.Event) {
+	// Reading handles pings and tells when the client goes away; clients
+	// have nothing to send
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, e := range backlog {
+		if conn.WriteJSON(e) != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamHeartbeat)) != nil {
+				return
+			}
+		case e, ok := <-subscription.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind, resume from the last event ID"),
+					time.Now().Add(time.Second))
+				return
+			}
+			if conn.WriteJSON(e) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+var (
+	ErrMissingTelemetryTimestamp = errors.New("telemetry timestamp is required")
+	ErrFutureTelemetryTimestamp  = errors.New("telemetry timestamp is in the future")
+	ErrEmptyTelemetry            = errors.New("telemetry record has no values")
+)
+
+// Check a telemetry record before it is stored
+func validateTelemetryRecord(r models.TelemetryRecord) error {
+	if r.Timestamp.IsZero() {
+		return ErrMissingTelemetryTimestamp
+	}
+	if r.Timestamp.InFuture() {
+		return ErrFutureTelemetryTimestamp
+	}
+	if r.BatteryVoltage == nil && r.BatteryPower == nil && r.SolarVoltage == nil && r.Humidity == nil {
+		return ErrEmptyTelemetry
+	}
+	return nil
+}
+
+// AddTelemetryToBuoy appends a housekeeping record to a buoy's telemetry
+// history. The buoy's battery, solar and humidity values follow the latest
+// record.
+func AddTelemetryToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		var record models.TelemetryRecord
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		if err := c.BindJSON(&record); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request",
+				Data:    nil,
+			})
+			return
+		}
+		if err := validateTelemetryRecord(record); err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		duplicate, err := buoys.AddTelemetry(ctx, objID, record)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add telemetry",
+				Data:    nil,
+			})
+			return
+		}
+		if duplicate[0] {
+			c.JSON(http.StatusOK, responses.BuoyResponse{
+				Status:  http.StatusOK,
+				Message: "Telemetry already recorded for this timestamp",
+				Data:    map[string]interface{}{"telemetry": record},
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.BuoyResponse{
+			Status:  http.StatusCreated,
+			Message: "Telemetry added to buoy successfully",
+			Data:    map[string]interface{}{"telemetry": record},
+		})
+	}
+}
+
+func GetBuoyTelemetry(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		if _, err := buoys.GetBuoy(ctx, objID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, responses.BuoyResponse{
+					Status:  http.StatusNotFound,
+					Message: "Buoy not found",
+					Data:    nil,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get telemetry",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra record to know whether another page follows
+		query.Limit = limit + 1
+		observations, err := buoys.QueryTelemetry(ctx, objID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get telemetry",
+				Data:    nil,
+			})
+			return
+		}
+
+		observations, nextCursor := nextPage(observations, limit, func(o models.TelemetryObservation) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+		})
+
+		records := make([]models.TelemetryRecord, len(observations))
+		for i, o := range observations {
+			records[i] = o.TelemetryRecord
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Telemetry found",
+			Data:    map[string]interface{}{"telemetry": records, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+	"od-api/uplink"
+)
+
+// WavesUplinkSink stores the waves readings buoys publish over MQTT the
+// same way as InsertWaveDataForBuoy, those of a message in one call to the
+// store, marking the readings that can never be stored
+func WavesUplinkSink(buoys storage.BuoyStore) uplink.Sink {
+	return func(buoyID string, waves []models.WavesData) []error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		errs := make([]error, len(waves))
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			for i := range errs {
+				errs[i] = fmt.Errorf("%w: %v", uplink.ErrInvalidReading, err)
+			}
+			return errs
+		}
+
+		var valid []models.WavesData
+		var indexes []int
+		for i, w := range waves {
+			if err := validateWavesData(w); err != nil {
+				errs[i] = fmt.Errorf("%w: %v", uplink.ErrInvalidReading, err)
+				continue
+			}
+			valid = append(valid, w)
+			indexes = append(indexes, i)
+		}
+		if len(valid) == 0 {
+			return errs
+		}
+
+		// Readings already stored for their timestamp are not added again
+		if _, err := buoys.AddWaves(ctx, objID, valid...); err != nil {
+			for _, i := range indexes {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+}
+
+// GetMQTTStatus reports the MQTT connection state and the messages received
+// on each topic
+func GetMQTTStatus(subscriber *uplink.Subscriber) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "MQTT uplink status",
+			Data:    map[string]interface{}{"mqtt": subscriber.Status()},
+		})
+	}
+}
@@ -2,23 +2,21 @@ package controllers
 
 import (
     "context"
-    "od-api/configs"
+    "errors"
     "od-api/models"
     "od-api/responses"
+    "od-api/storage"
     "net/http"
     "time"
 
     "github.com/gin-gonic/gin"
     "github.com/go-playground/validator/v10"
-    "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
-    "go.mongodb.org/mongo-driver/mongo"
 )
 
-var userCollection *mongo.Collection = configs.GetCollection(configs.DB, "users")
 var validate = validator.New()
 
-func CreateUser() gin.HandlerFunc {
+func CreateUser(users storage.UserStore) gin.HandlerFunc {
     return func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         var user models.User
@@ -37,32 +35,30 @@ func CreateUser() gin.HandlerFunc {
         }
 
         newUser := models.User{
-            Id:       primitive.NewObjectID(),
             Name:     user.Name,
             Location: user.Location,
             Title:    user.Title,
         }
 
-        result, err := userCollection.InsertOne(ctx, newUser)
+        userId, err := users.CreateUser(ctx, newUser)
         if err != nil {
             c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
             return
         }
 
-        c.JSON(http.StatusCreated, responses.UserResponse{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": result}})
+        c.JSON(http.StatusCreated, responses.UserResponse{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": gin.H{"InsertedID": userId}}})
     }
 }
 
-func GetAUser() gin.HandlerFunc {
+func GetAUser(users storage.UserStore) gin.HandlerFunc {
     return func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         userId := c.Param("userId")
-        var user models.User
         defer cancel()
 
         objId, _ := primitive.ObjectIDFromHex(userId)
 
-        err := userCollection.FindOne(ctx, bson.M{"id": objId}).Decode(&user)
+        user, err := users.GetUser(ctx, objId)
         if err != nil {
             c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
             return
@@ -72,7 +68,7 @@ func GetAUser() gin.HandlerFunc {
     }
 }
 
-func EditAUser() gin.HandlerFunc {
+func EditAUser(users storage.UserStore) gin.HandlerFunc {
     return func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         userId := c.Param("userId")
@@ -93,29 +89,23 @@ func EditAUser() gin.HandlerFunc {
             return
         }
 
-        update := bson.M{"name": user.Name, "location": user.Location, "title": user.Title}
-        result, err := userCollection.UpdateOne(ctx, bson.M{"id": objId}, bson.M{"$set": update})
-
+        updatedUser, err := users.UpdateUser(ctx, objId, user)
+        if errors.Is(err, storage.ErrNotFound) {
+            c.JSON(http.StatusNotFound,
+                responses.UserResponse{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "User with specified ID not found!"}},
+            )
+            return
+        }
         if err != nil {
             c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
             return
         }
 
-        //get updated user details
-        var updatedUser models.User
-        if result.MatchedCount == 1 {
-            err := userCollection.FindOne(ctx, bson.M{"id": objId}).Decode(&updatedUser)
-            if err != nil {
-                c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-                return
-            }
-        }
-
         c.JSON(http.StatusOK, responses.UserResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedUser}})
     }
 }
 
-func DeleteAUser() gin.HandlerFunc {
+func DeleteAUser(users storage.UserStore) gin.HandlerFunc {
     return func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         userId := c.Param("userId")
@@ -123,19 +113,17 @@ func DeleteAUser() gin.HandlerFunc {
 
         objId, _ := primitive.ObjectIDFromHex(userId)
 
-        result, err := userCollection.DeleteOne(ctx, bson.M{"id": objId})
-
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-            return
-        }
-
-        if result.DeletedCount < 1 {
+        err := users.DeleteUser(ctx, objId)
+        if errors.Is(err, storage.ErrNotFound) {
             c.JSON(http.StatusNotFound,
                 responses.UserResponse{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "User with specified ID not found!"}},
             )
             return
         }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+            return
+        }
 
         c.JSON(http.StatusOK,
             responses.UserResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": "User successfully deleted!"}},
@@ -143,32 +131,19 @@ func DeleteAUser() gin.HandlerFunc {
     }
 }
 
-func GetAllUsers() gin.HandlerFunc {
+func GetAllUsers(users storage.UserStore) gin.HandlerFunc {
     return func(c *gin.Context) {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-        var users []models.User
         defer cancel()
 
-        results, err := userCollection.Find(ctx, bson.M{})
-
+        allUsers, err := users.ListUsers(ctx)
         if err != nil {
             c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
             return
         }
 
-        //reading from the db in an optimal way
-        defer results.Close(ctx)
-        for results.Next(ctx) {
-            var singleUser models.User
-            if err = results.Decode(&singleUser); err != nil {
-                c.JSON(http.StatusInternalServerError, responses.UserResponse{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-            }
-
-            users = append(users, singleUser)
-        }
-
         c.JSON(http.StatusOK,
-            responses.UserResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": users}},
+            responses.UserResponse{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": allUsers}},
         )
     }
-}
\ No newline at end of file
+}
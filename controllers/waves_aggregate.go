@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Most buckets and readings GET /buoy/:buoyId/waves/aggregate aggregates in
+// one response. Readings are read in pages of aggregatePageSize.
+const (
+	maxAggregateBuckets  = 10000
+	maxAggregateReadings = 500000
+	aggregatePageSize    = 1000
+)
+
+// A WavesData field that can be aggregated. Circular fields are directions in
+// degrees and only support a circular mean. Value is nil for the fields the
+// buoy did not report.
+type aggregateField struct {
+	Name     string
+	Circular bool
+	Value    func(models.WavesData) *float64
+}
+
+var aggregateFields = []aggregateField{
+	{Name: "significantWaveHeight", Value: func(w models.WavesData) *float64 { return &w.SignificantWaveHeight }},
+	{Name: "peakPeriod", Value: func(w models.WavesData) *float64 { return w.PeakPeriod }},
+	{Name: "meanPeriod", Value: func(w models.WavesData) *float64 { return w.MeanPeriod }},
+	{Name: "peakDirection", Circular: true, Value: func(w models.WavesData) *float64 { return w.PeakDirection }},
+	{Name: "peakDirectionalSpread", Value: func(w models.WavesData) *float64 { return w.PeakDirectionalSpread }},
+	{Name: "meanDirection", Circular: true, Value: func(w models.WavesData) *float64 { return w.MeanDirection }},
+	{Name: "meanDirectionalSpread", Value: func(w models.WavesData) *float64 { return w.MeanDirectionalSpread }},
+	{Name: "maxWaveHeight", Value: func(w models.WavesData) *float64 { return w.MaxWaveHeight }},
+	{Name: "latitude", Value: func(w models.WavesData) *float64 { return &w.Latitude }},
+	{Name: "longitude", Value: func(w models.WavesData) *float64 { return &w.Longitude }},
+}
+
+// Readings of one time bucket, one slice of values per aggregateFields entry
+type wavesBucket struct {
+	Start  time.Time
+	Count  int
+	Values [][]float64
+}
+
+// Parse a comma separated list of mean, min, max and pNN (0 to 100) stats
+func parseStats(value string) ([]string, error) {
+	if value == "" {
+		return []string{"mean"}, nil
+	}
+
+	var stats []string
+	for _, stat := range strings.Split(value, ",") {
+		stat = strings.TrimSpace(stat)
+		switch {
+		case stat == "mean", stat == "min", stat == "max":
+		case strings.HasPrefix(stat, "p"):
+			p, err := strconv.ParseFloat(stat[1:], 64)
+			if err != nil || math.IsNaN(p) || p < 0 || p > 100 {
+				return nil, fmt.Errorf("invalid percentile %q", stat)
+			}
+		default:
+			return nil, fmt.Errorf("unknown stat %q", stat)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// Compute a stat accepted by parseStats over a non-empty set of values
+func computeStat(stat string, values []float64) float64 {
+	switch stat {
+	case "mean":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	case "min":
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	case "max":
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	}
+
+	p, _ := strconv.ParseFloat(stat[1:], 64)
+	return percentile(values, p)
+}
+
+// Linearly interpolated percentile p (0 to 100) of values
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// Mean of angles in degrees, in [0, 360). Averaging the unit vectors keeps
+// 350 and 10 degrees from averaging to 180.
+func circularMean(degrees []float64) float64 {
+	var sin, cos float64
+	for _, d := range degrees {
+		rad := d * math.Pi / 180
+		sin += math.Sin(rad)
+		cos += math.Cos(rad)
+	}
+	mean := math.Mod(math.Atan2(sin, cos)*180/math.Pi+360, 360)
+	if mean >= 360 {
+		// Rounding can leave tiny negative angles at exactly 360
+		mean = 0
+	}
+	return mean
+}
+
+func GetBuoyWavesAggregate(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		interval, err := time.ParseDuration(c.DefaultQuery("interval", "1h"))
+		if err != nil || interval < time.Second {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid interval, expected a duration of at least 1s such as 10m or 1h",
+				Data:    nil,
+			})
+			return
+		}
+
+		stats, err := parseStats(c.Query("stats"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid stats: " + err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		from, to, err := parseTimeRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		// The range holds at most maxAggregateBuckets buckets, so a buoy's
+		// whole history is never read at once. Without from, it starts as
+		// many buckets before to, or before now, as it can.
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+		if from.IsZero() && interval <= math.MaxInt64/maxAggregateBuckets {
+			from = end.Add(-interval * (maxAggregateBuckets - 1))
+		}
+		if end.Sub(from)/interval >= maxAggregateBuckets {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Too many buckets, use a larger interval or a shorter time range",
+				Data:    nil,
+			})
+			return
+		}
+
+		if _, err := buoys.GetBuoy(ctx, objID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, responses.BuoyResponse{
+					Status:  http.StatusNotFound,
+					Message: "Buoy not found",
+					Data:    nil,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to aggregate waves data",
+				Data:    nil,
+			})
+			return
+		}
+
+		buckets := map[time.Time]*wavesBucket{}
+		readings := 0
+		query := storage.RangeQuery{From: from, To: to, Limit: aggregatePageSize}
+		for {
+			page, err := buoys.QueryWaves(ctx, objID, query)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+					Status:  http.StatusInternalServerError,
+					Message: "Failed to aggregate waves data",
+					Data:    nil,
+				})
+				return
+			}
+			readings += len(page)
+			if readings > maxAggregateReadings {
+				c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+					Status:  http.StatusBadRequest,
+					Message: "Too many readings, use a shorter time range",
+					Data:    nil,
+				})
+				return
+			}
+
+			for _, observation := range page {
+				start := observation.Timestamp.UTC().Truncate(interval)
+
+				bucket, ok := buckets[start]
+				if !ok {
+					if len(buckets) == maxAggregateBuckets {
+						c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+							Status:  http.StatusBadRequest,
+							Message: "Too many buckets, use a larger interval or a shorter time range",
+							Data:    nil,
+						})
+						return
+					}
+					bucket = &wavesBucket{Start: start, Values: make([][]float64, len(aggregateFields))}
+					buckets[start] = bucket
+				}
+
+				// Fields the reading does not have are left out of the
+				// bucket's stats
+				bucket.Count++
+				for i, field := range aggregateFields {
+					if value := field.Value(observation.WavesData); value != nil {
+						bucket.Values[i] = append(bucket.Values[i], *value)
+					}
+				}
+			}
+
+			if len(page) < aggregatePageSize {
+				break
+			}
+			last := page[len(page)-1]
+			query.After = &storage.RangeCursor{Timestamp: last.Timestamp.Time, ID: last.ID}
+		}
+
+		ordered := make([]*wavesBucket, 0, len(buckets))
+		for _, bucket := range buckets {
+			ordered = append(ordered, bucket)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].Start.Before(ordered[j].Start) })
+
+		aggregated := make([]map[string]interface{}, 0, len(ordered))
+		for _, bucket := range ordered {
+			row := map[string]interface{}{
+				"start": bucket.Start.Format(time.RFC3339),
+				"count": bucket.Count,
+			}
+			for i, field := range aggregateFields {
+				if len(bucket.Values[i]) == 0 {
+					continue
+				}
+				values := map[string]float64{}
+				if field.Circular {
+					values["mean"] = circularMean(bucket.Values[i])
+				} else {
+					for _, stat := range stats {
+						values[stat] = computeStat(stat, bucket.Values[i])
+					}
+				}
+				row[field.Name] = values
+			}
+			aggregated = append(aggregated, row)
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Waves data aggregated",
+			Data:    map[string]interface{}{"interval": interval.String(), "buckets": aggregated},
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Limits of POST /buoy/:buoyId/waves:batch and POST /buoys/waves:batch.
+// MaxBatchBytes also limits NDBC files and Spotter payloads, and is the
+// largest body any ingestion endpoint reads.
+const (
+	maxBatchRecords = 10000
+	MaxBatchBytes   = 32 << 20
+	// Batches take longer than single readings to store
+	batchTimeout = 60 * time.Second
+)
+
+const (
+	batchAccepted  = "accepted"
+	batchDuplicate = "duplicate"
+	batchRejected  = "rejected"
+)
+
+// Outcome of one record of a batch, by its zero based position
+type batchResult struct {
+	Index  int    `json:"index"`
+	BuoyID string `json:"buoyId,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Waves reading of a fleet-wide batch
+type fleetWavesRecord struct {
+	BuoyID string `json:"buoyId"`
+	models.WavesData
+}
+
+// Split a batch body into its records. The body is either a JSON array or
+// NDJSON, one document per line; blank lines are skipped.
+func splitBatch(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var records []json.RawMessage
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	records := []json.RawMessage{}
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			records = append(records, line)
+		}
+	}
+	return records, nil
+}
+
+// Decode, validate and store the records of a batch, grouped by buoy so
+// each buoy's readings are inserted together. decode returns the buoy a
+// record belongs to.
+func ingestWavesBatch(c *gin.Context, buoys storage.BuoyStore, decode func(json.RawMessage) (primitive.ObjectID, models.WavesData, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBatchBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, responses.BuoyResponse{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Batch too large, the limit is %d bytes", MaxBatchBytes),
+			Data:    nil,
+		})
+		return
+	}
+	records, err := splitBatch(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request, expected a JSON array or NDJSON",
+			Data:    nil,
+		})
+		return
+	}
+	if len(records) == 0 || len(records) > maxBatchRecords {
+		c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("A batch holds 1 to %d records", maxBatchRecords),
+			Data:    nil,
+		})
+		return
+	}
+
+	results := make([]batchResult, len(records))
+	var order []primitive.ObjectID
+	waves := map[primitive.ObjectID][]models.WavesData{}
+	indexes := map[primitive.ObjectID][]int{}
+	for i, record := range records {
+		results[i] = batchResult{Index: i, Status: batchRejected}
+		buoyID, w, err := decode(record)
+		if !buoyID.IsZero() {
+			results[i].BuoyID = buoyID.Hex()
+		}
+		if err == nil {
+			err = validateWavesData(w)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if _, ok := waves[buoyID]; !ok {
+			order = append(order, buoyID)
+		}
+		waves[buoyID] = append(waves[buoyID], w)
+		indexes[buoyID] = append(indexes[buoyID], i)
+	}
+
+	for _, buoyID := range order {
+		duplicate, err := buoys.AddWaves(ctx, buoyID, waves[buoyID]...)
+		for j, i := range indexes[buoyID] {
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				results[i].Error = "Buoy not found"
+			case err != nil:
+				results[i].Error = "Failed to add waves data to buoy"
+			case duplicate[j]:
+				results[i].Status = batchDuplicate
+			default:
+				results[i].Status = batchAccepted
+			}
+		}
+	}
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	c.JSON(http.StatusOK, responses.BuoyResponse{
+		Status:  http.StatusOK,
+		Message: fmt.Sprintf("%d of %d records accepted", counts[batchAccepted], len(records)),
+		Data: map[string]interface{}{
+			"accepted":   counts[batchAccepted],
+			"duplicates": counts[batchDuplicate],
+			"rejected":   counts[batchRejected],
+			"results":    results,
+		},
+	})
+}
+
+// AddWavesBatchToBuoy stores many waves readings of one buoy at once, such
+// as the backlog a buoy buffered while offline
+func AddWavesBatchToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The router treats ":batch" as a parameter following "waves", so
+		// anything else after "waves" is not this endpoint
+		if c.Param("batch") != ":batch" {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Not found",
+				Data:    nil,
+			})
+			return
+		}
+
+		objID, err := primitive.ObjectIDFromHex(c.Param("buoyId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := buoys.GetBuoy(ctx, objID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, responses.BuoyResponse{
+					Status:  http.StatusNotFound,
+					Message: "Buoy not found",
+					Data:    nil,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get buoy",
+				Data:    nil,
+			})
+			return
+		}
+
+		ingestWavesBatch(c, buoys, func(record json.RawMessage) (primitive.ObjectID, models.WavesData, error) {
+			var w models.WavesData
+			if err := json.Unmarshal(record, &w); err != nil {
+				return objID, w, errors.New("invalid waves data")
+			}
+			return objID, w, nil
+		})
+	}
+}
+
+// AddFleetWavesBatch stores waves readings of several buoys at once. Each
+// record names its buoy in buoyId.
+func AddFleetWavesBatch(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("batch") != ":batch" {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Not found",
+				Data:    nil,
+			})
+			return
+		}
+
+		ingestWavesBatch(c, buoys, func(record json.RawMessage) (primitive.ObjectID, models.WavesData, error) {
+			var r fleetWavesRecord
+			if err := json.Unmarshal(record, &r); err != nil {
+				return primitive.NilObjectID, r.WavesData, errors.New("invalid waves data")
+			}
+			buoyID, err := primitive.ObjectIDFromHex(r.BuoyID)
+			if err != nil {
+				return primitive.NilObjectID, r.WavesData, errors.New("invalid buoy ID")
+			}
+			return buoyID, r.WavesData, nil
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/payloads"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Number of readings attached to a buoy returned by GET /buoy/:buoyId
+const recentWavesLimit = 100
+
+// Page sizes of GET /buoy/:buoyId/waves and the other range queries
+const (
+	defaultWavesPageSize = 100
+	maxWavesPageSize     = 1000
+)
+
+var (
+	ErrMissingTimestamp = errors.New("waves data timestamp is required")
+	ErrFutureTimestamp  = errors.New("waves data timestamp is in the future")
+	ErrInvalidPosition  = errors.New("waves data latitude or longitude out of range")
+	ErrInvalidWavesData = errors.New("invalid waves data")
+)
+
+// Check a waves reading before it is stored, against the fields of the waves
+// payload type, however it arrives
+func validateWavesData(w models.WavesData) error {
+	if w.Timestamp.IsZero() {
+		return ErrMissingTimestamp
+	}
+	if w.Timestamp.InFuture() {
+		return ErrFutureTimestamp
+	}
+	if w.Latitude < MinLatitude || w.Latitude > MaxLatitude || w.Longitude < MinLongitude || w.Longitude > MaxLongitude {
+		return ErrInvalidPosition
+	}
+	waves, _ := payloads.Lookup("waves")
+	if err := waves.Validate(payloads.WavesObservation(w)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWavesData, err)
+	}
+	return nil
+}
+
+// Range cursors are handed to clients as an opaque string
+func encodeRangeCursor(cursor storage.RangeCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.Hex()))
+}
+
+func decodeRangeCursor(s string) (storage.RangeCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return storage.RangeCursor{}, err
+	}
+	sep := strings.LastIndexByte(string(raw), '|')
+	if sep < 0 {
+		return storage.RangeCursor{}, errors.New("malformed cursor")
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, string(raw[:sep]))
+	if err != nil {
+		return storage.RangeCursor{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(string(raw[sep+1:]))
+	if err != nil {
+		return storage.RangeCursor{}, err
+	}
+	return storage.RangeCursor{Timestamp: timestamp, ID: id}, nil
+}
+
+// Parse an optional RFC3339 or Unix epoch query parameter
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := models.ParseTimestamp(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Time, nil
+}
+
+// Parse the optional from and to parameters. The error message is meant for
+// the client.
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid from time, expected RFC3339 or Unix epoch")
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid to time, expected RFC3339 or Unix epoch")
+	}
+	return from, to, nil
+}
+
+// Parse the from, to, limit and cursor parameters of a range query. The
+// error message is meant for the client.
+func parseRangeQuery(c *gin.Context) (storage.RangeQuery, int64, error) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return storage.RangeQuery{}, 0, err
+	}
+
+	limit := int64(defaultWavesPageSize)
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxWavesPageSize {
+			return storage.RangeQuery{}, 0, errors.New("Invalid limit, expected 1 to " + strconv.Itoa(maxWavesPageSize))
+		}
+	}
+
+	query := storage.RangeQuery{From: from, To: to}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeRangeCursor(value)
+		if err != nil {
+			return storage.RangeQuery{}, 0, errors.New("Invalid cursor")
+		}
+		query.After = &cursor
+	}
+	return query, limit, nil
+}
+
+// Trim records fetched with limit+1 to a page, and return the cursor of the
+// next page, or "" if this is the last one
+func nextPage[T any](records []T, limit int64, key func(T) storage.RangeCursor) ([]T, string) {
+	if int64(len(records)) <= limit {
+		return records, ""
+	}
+	records = records[:limit]
+	return records, encodeRangeCursor(key(records[len(records)-1]))
+}
+
+func GetBuoyWaves(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		query, limit, err := parseRangeQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		if _, err := buoys.GetBuoy(ctx, objID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, responses.BuoyResponse{
+					Status:  http.StatusNotFound,
+					Message: "Buoy not found",
+					Data:    nil,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get waves data",
+				Data:    nil,
+			})
+			return
+		}
+
+		// Fetch one extra reading to know whether another page follows
+		query.Limit = limit + 1
+		observations, err := buoys.QueryWaves(ctx, objID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get waves data",
+				Data:    nil,
+			})
+			return
+		}
+
+		observations, nextCursor := nextPage(observations, limit, func(o models.WaveObservation) storage.RangeCursor {
+			return storage.RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+		})
+
+		waves := make([]models.WavesData, len(observations))
+		for i, o := range observations {
+			waves[i] = o.WavesData
+		}
+
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: "Waves data found",
+			Data:    map[string]interface{}{"waves": waves, "nextCursor": nextCursor},
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/ndbc"
+	"od-api/netcdf"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// Exports read the time series in pages of this size, and may take longer
+// than a single page request
+const (
+	exportPageSize = 1000
+	exportTimeout  = 5 * time.Minute
+)
+
+// Columns of a waves CSV export, after timestamp, latitude and longitude and
+// before synthetic, with their CF-1.8 description in a netCDF export. value
+// is nil for the fields the buoy did not report.
+var wavesExportFields = []struct {
+	column       string
+	variable     string
+	standardName string
+	longName     string
+	units        string
+	value        func(models.WavesData) *float64
+}{
+	{"significantWaveHeight", "significant_wave_height", "sea_surface_wave_significant_height",
+		"significant wave height", "m", func(w models.WavesData) *float64 { return &w.SignificantWaveHeight }},
+	{"peakPeriod", "peak_period", "sea_surface_wave_period_at_variance_spectral_density_maximum",
+		"peak wave period", "s", func(w models.WavesData) *float64 { return w.PeakPeriod }},
+	{"meanPeriod", "mean_period", "sea_surface_wave_mean_period_from_variance_spectral_density_first_frequency_moment",
+		"mean wave period", "s", func(w models.WavesData) *float64 { return w.MeanPeriod }},
+	{"peakDirection", "peak_direction", "sea_surface_wave_from_direction_at_variance_spectral_density_maximum",
+		"peak wave direction", "degree", func(w models.WavesData) *float64 { return w.PeakDirection }},
+	{"peakDirectionalSpread", "peak_directional_spread", "sea_surface_wave_directional_spread_at_variance_spectral_density_maximum",
+		"peak wave directional spread", "degree", func(w models.WavesData) *float64 { return w.PeakDirectionalSpread }},
+	{"meanDirection", "mean_direction", "sea_surface_wave_from_direction",
+		"mean wave direction", "degree", func(w models.WavesData) *float64 { return w.MeanDirection }},
+	{"meanDirectionalSpread", "mean_directional_spread", "sea_surface_wave_directional_spread",
+		"mean wave directional spread", "degree", func(w models.WavesData) *float64 { return w.MeanDirectionalSpread }},
+	{"maxWaveHeight", "max_wave_height", "sea_surface_wave_maximum_height",
+		"maximum wave height", "m", func(w models.WavesData) *float64 { return w.MaxWaveHeight }},
+}
+
+// GetBuoyWavesExport returns a buoy's waves data between from and to as a
+// CSV, NDBC realtime2 or netCDF file. Text files are streamed page by page;
+// netCDF needs the record count up front, so the readings are gathered
+// first.
+func GetBuoyWavesExport(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "ndbc" && format != "netcdf" {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid format, expected csv, ndbc or netcdf",
+				Data:    nil,
+			})
+			return
+		}
+
+		from, to, err := parseTimeRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to export waves data",
+				Data:    nil,
+			})
+			return
+		}
+
+		// The first page is read before anything is written, so a failing
+		// store still gets an error response
+		query := storage.RangeQuery{From: from, To: to, Limit: exportPageSize}
+		page, err := buoys.QueryWaves(ctx, objID, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to export waves data",
+				Data:    nil,
+			})
+			return
+		}
+		next := func() ([]models.WaveObservation, error) {
+			if len(page) < exportPageSize {
+				return nil, nil
+			}
+			last := page[len(page)-1]
+			query.After = &storage.RangeCursor{Timestamp: last.Timestamp.Time, ID: last.ID}
+			return buoys.QueryWaves(ctx, objID, query)
+		}
+
+		if format != "netcdf" {
+			streamWavesExport(c, buoyID, format, page, next)
+			return
+		}
+
+		var waves []models.WaveObservation
+		for len(page) > 0 {
+			waves = append(waves, page...)
+			if page, err = next(); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+					Status:  http.StatusInternalServerError,
+					Message: "Failed to export waves data",
+					Data:    nil,
+				})
+				return
+			}
+		}
+
+		c.Header("Content-Type", "application/x-netcdf")
+		c.Header("Content-Disposition", `attachment; filename="`+buoyID+`-waves.nc"`)
+		c.Status(http.StatusOK)
+		if _, err := wavesNetCDF(buoy, waves).WriteTo(c.Writer); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// Write the pages of a text export as they are read
+func streamWavesExport(c *gin.Context, buoyID string, format string, page []models.WaveObservation, next func() ([]models.WaveObservation, error)) {
+	var write func(models.WavesData)
+	var flush func()
+	if format == "ndbc" {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+buoyID+`-waves.txt"`)
+		c.Status(http.StatusOK)
+
+		ndbc.WriteHeader(c.Writer)
+		write = func(w models.WavesData) { ndbc.WriteWaves(c.Writer, w) }
+		flush = func() {}
+	} else {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="`+buoyID+`-waves.csv"`)
+		c.Status(http.StatusOK)
+
+		csvWriter := csv.NewWriter(c.Writer)
+		header := []string{"timestamp", "latitude", "longitude"}
+		for _, f := range wavesExportFields {
+			header = append(header, f.column)
+		}
+		csvWriter.Write(append(header, "synthetic"))
+		write = func(w models.WavesData) {
+			row := []string{
+				w.Timestamp.UTC().Format(time.RFC3339Nano),
+				formatExportValue(w.Latitude),
+				formatExportValue(w.Longitude),
+			}
+			// Fields the buoy did not report are left empty
+			for _, f := range wavesExportFields {
+				value := f.value(w)
+				if value == nil {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, formatExportValue(*value))
+			}
+			csvWriter.Write(append(row, strconv.FormatBool(w.Synthetic)))
+		}
+		flush = csvWriter.Flush
+	}
+
+	var err error
+	for len(page) > 0 {
+		for _, o := range page {
+			write(o.WavesData)
+		}
+		flush()
+		c.Writer.Flush()
+
+		if page, err = next(); err != nil {
+			// The status is already sent; the file ends early
+			c.Error(err)
+			return
+		}
+	}
+}
+
+func formatExportValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Build a CF-1.8 trajectory dataset of a buoy's waves readings, with the
+// buoy's metadata as global attributes
+func wavesNetCDF(buoy models.Buoy, waves []models.WaveObservation) *netcdf.File {
+	id := buoy.ID.Hex()
+	times := make([]float64, len(waves))
+	latitudes := make([]float64, len(waves))
+	longitudes := make([]float64, len(waves))
+	for i, o := range waves {
+		times[i] = float64(o.Timestamp.UnixMilli()) / 1000
+		latitudes[i] = o.Latitude
+		longitudes[i] = o.Longitude
+	}
+
+	attributes := []netcdf.Attribute{
+		{Name: "Conventions", Value: "CF-1.8"},
+		{Name: "featureType", Value: "trajectory"},
+		{Name: "title", Value: "Waves data of buoy " + buoy.BuoyName},
+		{Name: "source", Value: "od-api"},
+		{Name: "date_created", Value: time.Now().UTC().Format(time.RFC3339)},
+		{Name: "buoy_id", Value: id},
+		{Name: "buoy_name", Value: buoy.BuoyName},
+		{Name: "buoy_location", Value: buoy.Location},
+		{Name: "payload_type", Value: buoy.PayloadType},
+	}
+	if len(buoy.Payloads) > 0 {
+		attributes = append(attributes, netcdf.Attribute{Name: "payloads", Value: strings.Join(buoy.Payloads, ",")})
+	}
+	if len(waves) > 0 {
+		attributes = append(attributes,
+			netcdf.Attribute{Name: "time_coverage_start", Value: waves[0].Timestamp.UTC().Format(time.RFC3339)},
+			netcdf.Attribute{Name: "time_coverage_end", Value: waves[len(waves)-1].Timestamp.UTC().Format(time.RFC3339)},
+			netcdf.Attribute{Name: "geospatial_lat_min", Value: minOf(latitudes)},
+			netcdf.Attribute{Name: "geospatial_lat_max", Value: maxOf(latitudes)},
+			netcdf.Attribute{Name: "geospatial_lon_min", Value: minOf(longitudes)},
+			netcdf.Attribute{Name: "geospatial_lon_max", Value: maxOf(longitudes)},
+		)
+	}
+
+	variables := []netcdf.Variable{
+		{Name: "trajectory", Dimensions: []string{"name_strlen"}, Data: id, Attributes: []netcdf.Attribute{
+			{Name: "cf_role", Value: "trajectory_id"},
+			{Name: "long_name", Value: "buoy ID"},
+		}},
+		{Name: "time", Dimensions: []string{"time"}, Data: times, Attributes: []netcdf.Attribute{
+			{Name: "standard_name", Value: "time"},
+			{Name: "long_name", Value: "time of the reading"},
+			{Name: "units", Value: "seconds since 1970-01-01T00:00:00Z"},
+			{Name: "calendar", Value: "standard"},
+			{Name: "axis", Value: "T"},
+		}},
+		{Name: "lat", Dimensions: []string{"time"}, Data: latitudes, Attributes: []netcdf.Attribute{
+			{Name: "standard_name", Value: "latitude"},
+			{Name: "long_name", Value: "latitude"},
+			{Name: "units", Value: "degrees_north"},
+			{Name: "axis", Value: "Y"},
+		}},
+		{Name: "lon", Dimensions: []string{"time"}, Data: longitudes, Attributes: []netcdf.Attribute{
+			{Name: "standard_name", Value: "longitude"},
+			{Name: "long_name", Value: "longitude"},
+			{Name: "units", Value: "degrees_east"},
+			{Name: "axis", Value: "X"},
+		}},
+	}
+	for _, f := range wavesExportFields {
+		// Fields the buoy did not report are filled with NaN
+		values := make([]float64, len(waves))
+		for i, o := range waves {
+			values[i] = math.NaN()
+			if value := f.value(o.WavesData); value != nil {
+				values[i] = *value
+			}
+		}
+		variables = append(variables, netcdf.Variable{Name: f.variable, Dimensions: []string{"time"}, Data: values, Attributes: []netcdf.Attribute{
+			{Name: "standard_name", Value: f.standardName},
+			{Name: "long_name", Value: f.longName},
+			{Name: "units", Value: f.units},
+			{Name: "_FillValue", Value: math.NaN()},
+			{Name: "coordinates", Value: "time lat lon"},
+		}})
+	}
+	synthetic := make([]int32, len(waves))
+	for i, o := range waves {
+		if o.Synthetic {
+			synthetic[i] = 1
+		}
+	}
+	variables = append(variables, netcdf.Variable{Name: "synthetic", Dimensions: []string{"time"}, Data: synthetic, Attributes: []netcdf.Attribute{
+		{Name: "long_name", Value: "reading generated by the simulator rather than measured"},
+		{Name: "flag_values", Value: []int32{0, 1}},
+		{Name: "flag_meanings", Value: "measured synthetic"},
+		{Name: "coordinates", Value: "time lat lon"},
+	}})
+
+	return &netcdf.File{
+		Dimensions: []netcdf.Dimension{
+			{Name: "time", Unlimited: true},
+			{Name: "name_strlen", Length: len(id)},
+		},
+		Attributes: attributes,
+		Variables:  variables,
+	}
+}
+
+func minOf(values []float64) float64 {
+	m := math.Inf(1)
+	for _, v := range values {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+func maxOf(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"od-api/models"
+	"od-api/netcdf"
+	"od-api/storage"
+)
+
+// A reading with only the required fields, and one with all of them
+func exportReadings() []models.WavesData {
+	start := time.Date(2017, 11, 8, 7, 0, 0, 0, time.UTC)
+	return []models.WavesData{
+		{
+			SignificantWaveHeight: 1.14,
+			Timestamp:             models.NewTimestamp(start),
+			Latitude:              34.30115,
+			Longitude:             -120.6133,
+		},
+		{
+			SignificantWaveHeight: 1.2,
+			PeakPeriod:            models.Float64(9.3),
+			MeanPeriod:            models.Float64(7.2),
+			PeakDirection:         models.Float64(0),
+			PeakDirectionalSpread: models.Float64(0),
+			MeanDirection:         models.Float64(287.1),
+			MeanDirectionalSpread: models.Float64(48.5),
+			MaxWaveHeight:         models.Float64(2.1),
+			Timestamp:             models.NewTimestamp(start.Add(30 * time.Minute)),
+			Latitude:              34.29883,
+			Longitude:             -120.61127,
+		},
+	}
+}
+
+func TestWavesCSVExportLeavesUnreportedFieldsEmpty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buoys := storage.NewMemoryBuoyStore()
+	ctx := context.Background()
+	id, err := buoys.CreateBuoy(ctx, models.Buoy{BuoyName: "Mavericks", Location: "California"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buoys.AddWaves(ctx, id, exportReadings()...); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/buoy/:buoyId/waves/export", GetBuoyWavesExport(buoys))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/buoy/"+id.Hex()+"/waves/export?format=csv", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(response.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"timestamp", "latitude", "longitude", "significantWaveHeight", "peakPeriod", "meanPeriod", "peakDirection", "peakDirectionalSpread", "meanDirection", "meanDirectionalSpread", "maxWaveHeight", "synthetic"},
+		{"2017-11-08T07:00:00Z", "34.30115", "-120.6133", "1.14", "", "", "", "", "", "", "", "false"},
+		// Reported zeros are values, not gaps
+		{"2017-11-08T07:30:00Z", "34.29883", "-120.61127", "1.2", "9.3", "7.2", "0", "0", "287.1", "48.5", "2.1", "false"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d:\n%s", len(rows), len(want), response.Body)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestWavesNetCDFFillsUnreportedFieldsWithNaN(t *testing.T) {
+	var waves []models.WaveObservation
+	for _, w := range exportReadings() {
+		waves = append(waves, models.WaveObservation{WavesData: w})
+	}
+	file := wavesNetCDF(models.Buoy{BuoyName: "Mavericks"}, waves)
+
+	variables := map[string]netcdf.Variable{}
+	for _, v := range file.Variables {
+		variables[v.Name] = v
+	}
+	for _, f := range wavesExportFields {
+		v, ok := variables[f.variable]
+		if !ok {
+			t.Errorf("%s: missing", f.variable)
+			continue
+		}
+
+		fill := math.Inf(1)
+		for _, a := range v.Attributes {
+			if a.Name == "_FillValue" {
+				fill, _ = a.Value.(float64)
+			}
+		}
+		if !math.IsNaN(fill) {
+			t.Errorf("%s: _FillValue = %v, want NaN", f.variable, fill)
+		}
+
+		values := v.Data.([]float64)
+		for i, w := range exportReadings() {
+			reported := f.value(w)
+			switch {
+			case reported == nil && !math.IsNaN(values[i]):
+				t.Errorf("%s[%d] = %v, want NaN for an unreported value", f.variable, i, values[i])
+			case reported != nil && values[i] != *reported:
+				t.Errorf("%s[%d] = %v, want %v", f.variable, i, values[i], *reported)
+			}
+		}
+	}
+}
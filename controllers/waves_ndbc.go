@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/ndbc"
+	"od-api/responses"
+	"od-api/storage"
+)
+
+// A line of an NDBC file that could not be imported
+type ndbcLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Position to give readings imported from an NDBC file, which has none: the
+// latitude and longitude parameters, or else the buoy's last known position.
+// The error message is meant for the client.
+func ndbcPosition(c *gin.Context, buoy models.Buoy) (float64, float64, error) {
+	lat, lon := c.Query("latitude"), c.Query("longitude")
+	if lat == "" && lon == "" {
+		if buoy.Position == nil {
+			return 0, 0, errors.New("Buoy has no known position, give latitude and longitude")
+		}
+		return buoy.Position.Coordinates[1], buoy.Position.Coordinates[0], nil
+	}
+
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return 0, 0, errors.New("Invalid latitude")
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return 0, 0, errors.New("Invalid longitude")
+	}
+	return latitude, longitude, nil
+}
+
+// AddNDBCWavesToBuoy imports the waves data of an NDBC realtime2 .txt or
+// .spec file. Lines without a wave height are skipped, as most lines of a
+// .txt file only hold meteorological data.
+func AddNDBCWavesToBuoy(buoys storage.BuoyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+		buoyID := c.Param("buoyId")
+		defer cancel()
+
+		objID, err := primitive.ObjectIDFromHex(buoyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid buoy ID",
+				Data:    nil,
+			})
+			return
+		}
+
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add waves data to buoy",
+				Data:    nil,
+			})
+			return
+		}
+
+		latitude, longitude, err := ndbcPosition(c, buoy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+
+		rows, err := ndbc.ReadWaves(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBatchBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, responses.BuoyResponse{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("File too large, the limit is %d bytes", MaxBatchBytes),
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.BuoyResponse{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid request, expected an NDBC realtime2 file with a column header",
+				Data:    nil,
+			})
+			return
+		}
+
+		skipped := 0
+		lineErrors := []ndbcLineError{}
+		var waves []models.WavesData
+		for _, row := range rows {
+			if errors.Is(row.Err, ndbc.ErrNoWaveHeight) {
+				skipped++
+				continue
+			}
+			if row.Err == nil {
+				row.Waves.Latitude, row.Waves.Longitude = latitude, longitude
+				row.Err = validateWavesData(row.Waves)
+			}
+			if row.Err != nil {
+				lineErrors = append(lineErrors, ndbcLineError{Line: row.Line, Error: row.Err.Error()})
+				continue
+			}
+			waves = append(waves, row.Waves)
+		}
+
+		var duplicate []bool
+		if len(waves) > 0 {
+			duplicate, err = buoys.AddWaves(ctx, objID, waves...)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, responses.BuoyResponse{
+				Status:  http.StatusNotFound,
+				Message: "Buoy not found",
+				Data:    nil,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.BuoyResponse{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to add waves data to buoy",
+				Data:    nil,
+			})
+			return
+		}
+
+		duplicates := 0
+		for _, d := range duplicate {
+			if d {
+				duplicates++
+			}
+		}
+		accepted := len(waves) - duplicates
+		c.JSON(http.StatusOK, responses.BuoyResponse{
+			Status:  http.StatusOK,
+			Message: fmt.Sprintf("%d waves readings imported", accepted),
+			Data: map[string]interface{}{
+				"accepted":   accepted,
+				"duplicates": duplicates,
+				"skipped":    skipped,
+				"rejected":   len(lineErrors),
+				"errors":     lineErrors,
+			},
+		})
+	}
+}
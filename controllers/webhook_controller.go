@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/responses"
+	"od-api/storage"
+	"od-api/webhook"
+)
+
+var ErrInvalidWebhookURL = errors.New("webhook url must be an absolute http or https URL")
+
+// Decode and check the webhook of a request. It writes the error response
+// and returns false if the webhook is invalid.
+func bindWebhook(c *gin.Context, hook *models.Webhook) bool {
+	if err := c.BindJSON(hook); err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid request",
+			Data:    nil,
+		})
+		return false
+	}
+
+	err := webhook.CheckEvents(hook.Events)
+	if u, parseErr := url.Parse(hook.URL); parseErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		err = ErrInvalidWebhookURL
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return false
+	}
+	return true
+}
+
+// Parse a webhook or dead letter ID path parameter. It writes the error
+// response and returns false if it is invalid.
+func webhookParam(c *gin.Context, name string) (primitive.ObjectID, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, responses.Response{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid " + name,
+			Data:    nil,
+		})
+		return objID, false
+	}
+	return objID, true
+}
+
+// Webhooks are listed without their secret, which is only shown when it
+// is set
+func redactWebhook(hook models.Webhook) models.Webhook {
+	hook.Secret = ""
+	return hook
+}
+
+func webhookNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, responses.Response{
+		Status:  http.StatusNotFound,
+		Message: "Webhook not found",
+		Data:    nil,
+	})
+}
+
+// CreateWebhook subscribes a URL to events. A secret is generated if the
+// request has none; the response is the only one to show it.
+func CreateWebhook(webhooks storage.WebhookStore, dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var hook models.Webhook
+		defer cancel()
+
+		if !bindWebhook(c, &hook) {
+			return
+		}
+		if hook.Secret == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{
+					Status:  http.StatusInternalServerError,
+					Message: "Failed to create webhook",
+					Data:    nil,
+				})
+				return
+			}
+			hook.Secret = hex.EncodeToString(secret)
+		}
+		hook.CreatedAt = models.NewTimestamp(time.Now())
+
+		id, err := webhooks.CreateWebhook(ctx, hook)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to create webhook",
+				Data:    nil,
+			})
+			return
+		}
+		hook.ID = id
+		dispatcher.Put(hook)
+
+		c.JSON(http.StatusCreated, responses.Response{
+			Status:  http.StatusCreated,
+			Message: "Webhook created",
+			Data:    map[string]interface{}{"webhook": hook},
+		})
+	}
+}
+
+func GetWebhooks(webhooks storage.WebhookStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		hooks, err := webhooks.ListWebhooks(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get webhooks",
+				Data:    nil,
+			})
+			return
+		}
+		for i := range hooks {
+			hooks[i] = redactWebhook(hooks[i])
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Webhooks found",
+			Data:    map[string]interface{}{"webhooks": hooks},
+		})
+	}
+}
+
+func GetWebhook(webhooks storage.WebhookStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objID, ok := webhookParam(c, "webhookId")
+		if !ok {
+			return
+		}
+
+		hook, err := webhooks.GetWebhook(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			webhookNotFound(c)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get webhook",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Webhook found",
+			Data:    map[string]interface{}{"webhook": redactWebhook(hook)},
+		})
+	}
+}
+
+// EditWebhook replaces a webhook's URL, events and disabled flag. The
+// secret is replaced only if the request has one.
+func EditWebhook(webhooks storage.WebhookStore, dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var hook models.Webhook
+		defer cancel()
+
+		objID, ok := webhookParam(c, "webhookId")
+		if !ok {
+			return
+		}
+		if !bindWebhook(c, &hook) {
+			return
+		}
+
+		existing, err := webhooks.GetWebhook(ctx, objID)
+		if err == nil {
+			if hook.Secret == "" {
+				hook.Secret = existing.Secret
+			}
+			hook.CreatedAt = existing.CreatedAt
+			hook, err = webhooks.UpdateWebhook(ctx, objID, hook)
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			webhookNotFound(c)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to update webhook",
+				Data:    nil,
+			})
+			return
+		}
+		dispatcher.Put(hook)
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Webhook updated",
+			Data:    map[string]interface{}{"webhook": redactWebhook(hook)},
+		})
+	}
+}
+
+// DeleteWebhook deletes a webhook, its dead letters and its pending
+// deliveries
+func DeleteWebhook(webhooks storage.WebhookStore, dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objID, ok := webhookParam(c, "webhookId")
+		if !ok {
+			return
+		}
+
+		err := webhooks.DeleteWebhook(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			webhookNotFound(c)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to delete webhook",
+				Data:    nil,
+			})
+			return
+		}
+		dispatcher.Remove(objID)
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Webhook deleted",
+			Data:    nil,
+		})
+	}
+}
+
+func GetDeadLetters(webhooks storage.WebhookStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objID, ok := webhookParam(c, "webhookId")
+		if !ok {
+			return
+		}
+
+		_, err := webhooks.GetWebhook(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			webhookNotFound(c)
+			return
+		}
+		var letters []models.DeadLetter
+		if err == nil {
+			letters, err = webhooks.ListDeadLetters(ctx, objID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to get dead letters",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Dead letters found",
+			Data:    map[string]interface{}{"deadLetters": letters},
+		})
+	}
+}
+
+// Look up a dead letter of the webhook in the path. It writes the error
+// response and returns false if there is none.
+func deadLetterTarget(ctx context.Context, c *gin.Context, webhooks storage.WebhookStore) (models.DeadLetter, bool) {
+	webhookID, ok := webhookParam(c, "webhookId")
+	if !ok {
+		return models.DeadLetter{}, false
+	}
+	letterID, ok := webhookParam(c, "deadLetterId")
+	if !ok {
+		return models.DeadLetter{}, false
+	}
+
+	letter, err := webhooks.GetDeadLetter(ctx, letterID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && letter.WebhookID != webhookID) {
+		c.JSON(http.StatusNotFound, responses.Response{
+			Status:  http.StatusNotFound,
+			Message: "Dead letter not found",
+			Data:    nil,
+		})
+		return letter, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, responses.Response{
+			Status:  http.StatusInternalServerError,
+			Message: "Failed to get dead letter",
+			Data:    nil,
+		})
+		return letter, false
+	}
+	return letter, true
+}
+
+// RetryDeadLetter sends a dead letter again, with the same event ID, and
+// removes it. If every retry fails again it becomes a new dead letter.
+func RetryDeadLetter(webhooks storage.WebhookStore, dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		letter, ok := deadLetterTarget(ctx, c, webhooks)
+		if !ok {
+			return
+		}
+		if err := webhooks.DeleteDeadLetter(ctx, letter.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to retry dead letter",
+				Data:    nil,
+			})
+			return
+		}
+		dispatcher.Redeliver(letter)
+
+		c.JSON(http.StatusAccepted, responses.Response{
+			Status:  http.StatusAccepted,
+			Message: "Dead letter queued for delivery",
+			Data:    nil,
+		})
+	}
+}
+
+func DeleteDeadLetter(webhooks storage.WebhookStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		letter, ok := deadLetterTarget(ctx, c, webhooks)
+		if !ok {
+			return
+		}
+		err := webhooks.DeleteDeadLetter(ctx, letter.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, responses.Response{
+				Status:  http.StatusInternalServerError,
+				Message: "Failed to delete dead letter",
+				Data:    nil,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{
+			Status:  http.StatusOK,
+			Message: "Dead letter deleted",
+			Data:    nil,
+		})
+	}
+}
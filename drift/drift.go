@@ -0,0 +1,205 @@
+// Package drift checks the positions buoys report against the anchor they
+// were deployed at, and records each time a buoy leaves the watch circle
+// around it or comes back.
+package drift
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/geo"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// A buoy adrift is back once it is within this fraction of its watch
+// radius, so fixes wandering on the edge of the circle do not raise an
+// event each
+const returnFraction = 0.9
+
+// Where a buoy stands
+type buoyState struct {
+	adrift bool
+	// Time of the last fix checked
+	last time.Time
+}
+
+// Detector checks each new fix of a buoy with an anchor. It keeps whether
+// each buoy is adrift in memory; after a restart it is taken from the
+// buoy's latest event.
+type Detector struct {
+	events storage.DriftStore
+	radius float64
+
+	mu     sync.Mutex
+	states map[primitive.ObjectID]*buoyState
+	// The fixes of a buoy are checked one batch at a time, and those of
+	// different buoys at the same time
+	buoyLocks map[primitive.ObjectID]*sync.Mutex
+}
+
+// NewDetector returns a detector giving buoys without a watch radius of
+// their own one of defaultRadius meters
+func NewDetector(events storage.DriftStore, defaultRadius float64) *Detector {
+	return &Detector{
+		events:    events,
+		radius:    defaultRadius,
+		states:    make(map[primitive.ObjectID]*buoyState),
+		buoyLocks: make(map[primitive.ObjectID]*sync.Mutex),
+	}
+}
+
+// WatchRadius returns the radius in meters a buoy may move from its anchor
+func (d *Detector) WatchRadius(buoy models.Buoy) float64 {
+	if buoy.WatchRadius > 0 {
+		return buoy.WatchRadius
+	}
+	return d.radius
+}
+
+// The lock of a buoy's checks
+func (d *Detector) buoyLock(buoyID primitive.ObjectID) *sync.Mutex {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lock, ok := d.buoyLocks[buoyID]
+	if !ok {
+		lock = &sync.Mutex{}
+		d.buoyLocks[buoyID] = lock
+	}
+	return lock
+}
+
+// The state of a buoy, taken from its latest event the first time. Must be
+// called with the buoy locked; the detector is only locked to look the
+// state up and keep it.
+func (d *Detector) state(ctx context.Context, buoyID primitive.ObjectID) (*buoyState, error) {
+	d.mu.Lock()
+	st, ok := d.states[buoyID]
+	d.mu.Unlock()
+	if ok {
+		return st, nil
+	}
+
+	st = &buoyState{}
+	latest, err := d.events.LatestDriftEvent(ctx, buoyID)
+	switch {
+	case err == nil:
+		st.adrift = latest.State == models.DriftAdrift
+		st.last = latest.Timestamp.Time
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+	d.mu.Lock()
+	d.states[buoyID] = st
+	d.mu.Unlock()
+	return st, nil
+}
+
+// Check the new fixes of a buoy, in time order. Fixes older than the last
+// one checked, such as a late backfill, are skipped so they cannot flip
+// the buoy's state.
+func (d *Detector) check(ctx context.Context, buoys storage.BuoyStore, buoyID primitive.ObjectID, waves []models.WavesData) error {
+	buoy, err := buoys.GetBuoy(ctx, buoyID)
+	if err != nil {
+		return err
+	}
+	if buoy.Anchor == nil {
+		return nil
+	}
+	anchorLat, anchorLon := buoy.Anchor.Coordinates[1], buoy.Anchor.Coordinates[0]
+	radius := d.WatchRadius(buoy)
+	sort.Slice(waves, func(i, j int) bool { return waves[i].Timestamp.Before(waves[j].Timestamp.Time) })
+
+	lock := d.buoyLock(buoyID)
+	lock.Lock()
+	defer lock.Unlock()
+	st, err := d.state(ctx, buoyID)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range waves {
+		if !w.Timestamp.After(st.last) {
+			continue
+		}
+
+		distance := geo.DistanceKm(anchorLat, anchorLon, w.Latitude, w.Longitude) * 1000
+		state := ""
+		switch {
+		case !st.adrift && distance > radius:
+			state = models.DriftAdrift
+		case st.adrift && distance <= radius*returnFraction:
+			state = models.DriftReturned
+		}
+
+		if state != "" {
+			_, err := d.events.AddDriftEvent(ctx, models.DriftEvent{
+				BuoyID:      buoyID,
+				State:       state,
+				Distance:    distance,
+				Bearing:     geo.BearingDegrees(anchorLat, anchorLon, w.Latitude, w.Longitude),
+				Position:    models.NewGeoPoint(w.Latitude, w.Longitude),
+				Anchor:      buoy.Anchor,
+				WatchRadius: radius,
+				Timestamp:   w.Timestamp,
+				CreatedAt:   models.NewTimestamp(time.Now()),
+				Exercise:    w.Synthetic,
+			})
+			// The state is left as it was, so the fix is checked again if
+			// it is sent again
+			if err != nil {
+				return err
+			}
+			st.adrift = state == models.DriftAdrift
+		}
+		st.last = w.Timestamp.Time
+	}
+	return nil
+}
+
+// Store wraps a BuoyStore so that the fixes of the waves readings it stores
+// are checked against the buoys' watch circles
+func (d *Detector) Store(buoys storage.BuoyStore) storage.BuoyStore {
+	return &checkingStore{BuoyStore: buoys, detector: d}
+}
+
+type checkingStore struct {
+	storage.BuoyStore
+	detector *Detector
+}
+
+func (s *checkingStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddWaves(ctx, id, waves...)
+	if err != nil {
+		return duplicate, err
+	}
+	var stored []models.WavesData
+	for i, w := range waves {
+		if !duplicate[i] {
+			stored = append(stored, w)
+		}
+	}
+	if len(stored) > 0 {
+		if err := s.detector.check(ctx, s.BuoyStore, id, stored); err != nil {
+			log.Println("drift: failed to check fixes of buoy", id.Hex(), ":", err)
+		}
+	}
+	return duplicate, nil
+}
+
+// DeleteBuoy forgets the state and lock of the deleted buoy
+func (s *checkingStore) DeleteBuoy(ctx context.Context, id primitive.ObjectID) error {
+	if err := s.BuoyStore.DeleteBuoy(ctx, id); err != nil {
+		return err
+	}
+	s.detector.mu.Lock()
+	defer s.detector.mu.Unlock()
+	delete(s.detector.states, id)
+	delete(s.detector.buoyLocks, id)
+	return nil
+}
@@ -0,0 +1,32 @@
+package geo
+
+import "math"
+
+// Mean Earth radius used for great-circle distances
+const EarthRadiusKm = 6371.0
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// DistanceKm returns the haversine great-circle distance between two points
+// given in degrees.
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BearingDegrees returns the initial great-circle bearing from the first
+// point to the second, in degrees clockwise from true north in [0, 360)
+func BearingDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dLon := toRadians(lon2 - lon1)
+
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
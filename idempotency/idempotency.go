@@ -0,0 +1,227 @@
+// Package idempotency lets clients retry POST requests safely. A request
+// carrying an Idempotency-Key header is handled once; repeats of it within
+// the retention period get the first response back.
+package idempotency
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"od-api/responses"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// Set on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength  = 255
+	sweepInterval = time.Hour
+	// Larger responses are not kept, and the requests are handled again
+	// when repeated
+	maxResponseBytes = 1 << 20
+	// Past either limit the oldest keys are forgotten first, so a client
+	// sending unique keys cannot exhaust memory
+	maxEntries     = 10000
+	maxStoredBytes = 64 << 20
+)
+
+type entry struct {
+	request     [sha256.Size]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+	scope       string
+	element     *list.Element
+}
+
+// Keys remembers the responses to requests with an Idempotency-Key
+type Keys struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxBody int64
+	entries map[string]*entry
+	// Entries from oldest to newest, and the size of their stored bodies
+	order     *list.List
+	stored    int
+	nextSweep time.Time
+}
+
+// New returns a Keys that keeps each response for ttl. Requests with a key
+// and a body over maxBody bytes are rejected, as the handlers would reject
+// them, before the body is read into memory.
+func New(ttl time.Duration, maxBody int64) *Keys {
+	return &Keys{
+		ttl:       ttl,
+		maxBody:   maxBody,
+		entries:   make(map[string]*entry),
+		order:     list.New(),
+		nextSweep: time.Now().Add(sweepInterval),
+	}
+}
+
+// Captures the response body while writing it, up to maxResponseBytes
+type recorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *recorder) record(n int) bool {
+	if r.overflow || r.body.Len()+n > maxResponseBytes {
+		r.overflow = true
+		r.body.Reset()
+		return false
+	}
+	return true
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.record(len(b)) {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	if r.record(len(s)) {
+		r.body.WriteString(s)
+	}
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Middleware handles requests without the header as usual. Keys are scoped
+// to the method and path. Reusing a key for a different body is rejected,
+// as is a repeat that arrives while the first request is still running.
+// Server errors, handlers that panic and responses over maxResponseBytes are
+// not kept, so those requests can be retried.
+func (k *Keys) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			abort(c, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, k.maxBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abort(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request too large, the limit is %d bytes", k.maxBody))
+			return
+		}
+		if err != nil {
+			abort(c, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		request := sha256.Sum256(body)
+		scope := c.Request.Method + " " + c.Request.URL.Path + " " + key
+
+		k.mu.Lock()
+		now := time.Now()
+		k.sweep(now)
+		e, ok := k.entries[scope]
+		if ok && now.After(e.expires) {
+			k.remove(e)
+			ok = false
+		}
+		if !ok {
+			e = &entry{request: request, expires: now.Add(k.ttl), scope: scope}
+			e.element = k.order.PushBack(e)
+			k.entries[scope] = e
+			k.evict()
+		}
+		k.mu.Unlock()
+
+		if ok {
+			switch {
+			case e.request != request:
+				abort(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case !e.done:
+				abort(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			default:
+				c.Header(ReplayedHeader, "true")
+				c.Data(e.status, e.contentType, e.body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &recorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		// Deferred so the key is released if the handler panics
+		defer func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			if !completed || writer.overflow || writer.Status() >= http.StatusInternalServerError {
+				if k.entries[scope] == e {
+					k.remove(e)
+				}
+				return
+			}
+			e.done = true
+			e.status = writer.Status()
+			e.contentType = writer.Header().Get("Content-Type")
+			e.body = writer.body.Bytes()
+			if k.entries[scope] == e {
+				k.stored += len(e.body)
+				k.evict()
+			}
+		}()
+		c.Next()
+		completed = true
+	}
+}
+
+// Drop expired responses, at most once per sweep interval. Called with the
+// lock held.
+func (k *Keys) sweep(now time.Time) {
+	if now.Before(k.nextSweep) {
+		return
+	}
+	for _, e := range k.entries {
+		if e.done && now.After(e.expires) {
+			k.remove(e)
+		}
+	}
+	k.nextSweep = now.Add(sweepInterval)
+}
+
+// Forget the oldest entries until both limits are met. A request still
+// running whose entry is evicted is handled as usual, but its response is
+// not kept. Called with the lock held.
+func (k *Keys) evict() {
+	for len(k.entries) > maxEntries || k.stored > maxStoredBytes {
+		k.remove(k.order.Front().Value.(*entry))
+	}
+}
+
+// Called with the lock held
+func (k *Keys) remove(e *entry) {
+	delete(k.entries, e.scope)
+	k.order.Remove(e.element)
+	k.stored -= len(e.body)
+}
+
+func abort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, responses.BuoyResponse{
+		Status:  status,
+		Message: message,
+		Data:    nil,
+	})
+}
@@ -1,13 +1,35 @@
 package main
 
 import (
+        "context"
+        "encoding/json"
+        "errors"
+        "flag"
+        "log"
+        "net/http"
+        "os"
+        "os/signal"
+        "sync"
+        "syscall"
         "time"
 	"fmt"
 
 	"od-api/configs"
+        "od-api/alerting"
 	"od-api/routes" //add this
         "od-api/controllers"
+        "od-api/drift"
+        "od-api/migrations"
+        "od-api/models"
+        "od-api/presence"
+        "od-api/simulator"
+        "od-api/storage"
+        "od-api/stream"
+        "od-api/uplink"
+        "od-api/webhook"
 	"github.com/gin-gonic/gin"
+        "go.mongodb.org/mongo-driver/bson/primitive"
+        "go.mongodb.org/mongo-driver/mongo"
 )
 
 var buoyInitialCoordinates = map[string]struct {
@@ -20,23 +42,310 @@ var buoyInitialCoordinates = map[string]struct {
 	"1b2fd03771ad3a8abf25f82e": {InitialLatitude: 34.30027, InitialLongitude: -120.60915},
 }
 
-func generateAndInsertData(buoyID string, initialLatitude, initialLongitude float64) {
-	for {
-		// Generate realistic wave data for the specific buoy
-		waveData := controllers.GenerateRandomWavesData(initialLatitude, initialLongitude)
+// Give the buoys deployed at buoyInitialCoordinates their anchor, unless
+// they already have one
+func seedAnchors(buoys storage.BuoyStore) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-		// Insert wave data into the database for the specific buoy ID
-		err := controllers.InsertWaveDataForBuoy(buoyID, waveData)
+	for id, coordinates := range buoyInitialCoordinates {
+		objID, err := primitive.ObjectIDFromHex(id)
 		if err != nil {
-			fmt.Println("Failed to insert wave data for buoy", buoyID, ":", err)
+			continue
 		}
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if err != nil || buoy.Anchor != nil {
+			continue
+		}
+		buoy.Anchor = models.NewGeoPoint(coordinates.InitialLatitude, coordinates.InitialLongitude)
+		if _, err := buoys.UpdateBuoy(ctx, objID, buoy); err != nil {
+			fmt.Println("Failed to set the anchor of buoy", id, ":", err)
+		}
+	}
+}
 
-		// Wait for 1 minute before generating and inserting the next data for this buoy
-		time.Sleep(1 * time.Minute)
+// Buoy simulated when no -simulate file is given
+const demoBuoyID = "64c1de1bccc77c103ab51ed1"
+
+// The buoys to simulate: those listed in the JSON file at path, or the demo
+// buoy. Buoys listed without an anchor are simulated around their own. A
+// listed buoy stored without being marked simulated is an error, while the
+// demo buoy is then not simulated.
+func simulatedBuoys(path string, buoys storage.BuoyStore) ([]simulator.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if path == "" {
+		objID, _ := primitive.ObjectIDFromHex(demoBuoyID)
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Println("Demo buoy", demoBuoyID, "does not exist, so it is not simulated")
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !buoy.Simulated {
+			log.Println("Demo buoy", demoBuoyID, "is not marked simulated, so it is not simulated")
+			return nil, nil
+		}
+		coordinates := buoyInitialCoordinates[demoBuoyID]
+		return []simulator.Config{{
+			BuoyID:        demoBuoyID,
+			Seed:          1,
+			Anchor:        models.NewGeoPoint(coordinates.InitialLatitude, coordinates.InitialLongitude),
+			MeanDirection: 290,
+		}}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
+	var configs []simulator.Config
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, err
+	}
+
+	for i, config := range configs {
+		objID, err := primitive.ObjectIDFromHex(config.BuoyID)
+		if err != nil {
+			continue
+		}
+		buoy, err := buoys.GetBuoy(ctx, objID)
+		if err != nil {
+			continue
+		}
+		if !buoy.Simulated {
+			return nil, fmt.Errorf("buoy %s: %w", config.BuoyID, controllers.ErrNotSimulatedBuoy)
+		}
+		if config.Anchor == nil {
+			configs[i].Anchor = buoy.Anchor
+		}
+	}
+	return configs, nil
+}
+
+// The drill scenario in the YAML or JSON file at path, with the anchor of its
+// buoy if it gives none. Its buoy, if stored, must be marked simulated.
+func drillScenario(path string, buoys storage.BuoyStore) (simulator.Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return simulator.Scenario{}, err
+	}
+	scenario, err := simulator.ParseScenario(raw)
+	if err != nil {
+		return simulator.Scenario{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	objID, err := primitive.ObjectIDFromHex(scenario.Buoy.BuoyID)
+	if err != nil {
+		return scenario, nil
+	}
+	buoy, err := buoys.GetBuoy(ctx, objID)
+	if err != nil {
+		return scenario, nil
+	}
+	if !buoy.Simulated {
+		return simulator.Scenario{}, fmt.Errorf("buoy %s: %w", scenario.Buoy.BuoyID, controllers.ErrNotSimulatedBuoy)
+	}
+	if scenario.Buoy.Anchor == nil {
+		scenario.Buoy.Anchor = buoy.Anchor
+	}
+	return scenario, nil
+}
+
+// Start a background loop, which wg waits for
+func startLoop(wg *sync.WaitGroup, loop func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		loop()
+	}()
+}
+
+// Move data written by older versions to the current layout
+func runMigrations(client *mongo.Client) {
+        migrated, err := migrations.SplitEmbeddedWaves(context.Background(), client)
+        if err != nil {
+                log.Fatal("Waves migration failed: ", err)
+        }
+        fmt.Println("Migrated waves data of", migrated, "buoys")
+
+        converted, invalid, err := migrations.ConvertWaveTimestamps(context.Background(), client)
+        if err != nil {
+                log.Fatal("Timestamp migration failed: ", err)
+        }
+        fmt.Println("Converted", converted, "waves timestamps to dates")
+        for _, id := range invalid {
+                fmt.Println("Waves reading", id.Hex(), "has an unparseable timestamp and was left unchanged")
+        }
+
+        positioned, err := migrations.BackfillBuoyPositions(context.Background(), client)
+        if err != nil {
+                log.Fatal("Position migration failed: ", err)
+        }
+        fmt.Println("Set the last known position of", positioned, "buoys")
+
+        removed, err := migrations.RemoveDuplicateReadings(context.Background(), client)
+        if err != nil {
+                log.Fatal("Duplicate readings migration failed: ", err)
+        }
+        fmt.Println("Removed", removed, "duplicate readings")
+
+        unset, err := migrations.UnsetUnreportedWaveFields(context.Background(), client)
+        if err != nil {
+                log.Fatal("Unreported waves fields migration failed: ", err)
+        }
+        fmt.Println("Removed", unset, "zero values of unreported waves fields")
 }
 
 func main() {
+        storageKind := flag.String("storage", "mongo", "storage backend: mongo, memory or bolt")
+        boltPath := flag.String("bolt-path", "od-api.db", "database file of the bolt storage backend")
+        migrate := flag.Bool("migrate", false, "move embedded buoy waves arrays into the waves collection, convert string timestamps to dates, backfill buoy positions, remove duplicate readings, remove zero values of unreported waves fields and exit (mongo only)")
+        exportDir := flag.String("export", "", "write the bolt database to this directory as mongoimport files and exit (bolt only)")
+        mqttBroker := flag.String("mqtt-broker", "", "MQTT broker URL such as tcp://localhost:1883 to receive buoy uplinks from; credentials are read from MQTT_USERNAME and MQTT_PASSWORD")
+        mqttTopic := flag.String("mqtt-topic", "od/buoys/{buoyId}/waves", "MQTT topic pattern of waves uplinks")
+        mqttClientID := flag.String("mqtt-client-id", "", "MQTT client ID, random if empty")
+        mqttQoS := flag.Int("mqtt-qos", 1, "MQTT subscription QoS: 0, 1 or 2")
+        reportInterval := flag.Duration("report-interval", 30*time.Minute, "time expected between the reports of buoys without a report interval of their own")
+        watchRadius := flag.Float64("watch-radius", 2000, "meters buoys without a watch radius of their own may move from their anchor")
+        simulate := flag.String("simulate", "", "JSON file listing the buoys to simulate at startup and their settings; only the demo buoy "+demoBuoyID+" is simulated if empty")
+        scenarioPath := flag.String("scenario", "", "YAML or JSON drill scenario to play at startup; its buoy plays the scenario rather than being simulated")
+        streamHistory := flag.Int("stream-history", 10000, "number of recent events kept for stream clients resuming from a last event ID")
+        flag.Parse()
+
+        // Cancelled on SIGINT or SIGTERM to shut the server down
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+
+        if *migrate && *storageKind != "mongo" {
+                log.Fatal("-migrate needs -storage=mongo")
+        }
+        if *exportDir != "" && *storageKind != "bolt" {
+                log.Fatal("-export needs -storage=bolt")
+        }
+        if *reportInterval <= 0 {
+                log.Fatal("-report-interval must be positive")
+        }
+        if *watchRadius <= 0 {
+                log.Fatal("-watch-radius must be positive")
+        }
+
+        var buoys storage.BuoyStore
+        var users storage.UserStore
+        var alerts storage.AlertStore
+        var webhooks storage.WebhookStore
+        var statuses storage.StatusStore
+        var drifts storage.DriftStore
+        switch *storageKind {
+        case "mongo":
+                // run database
+                client := configs.ConnectDB()
+
+                // Migrations run first, as unique indexes can only be
+                // created once duplicate readings are removed
+                if *migrate {
+                        runMigrations(client)
+                }
+                ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+                defer cancel()
+                if err := migrations.EnsureIndexes(ctx, client); err != nil {
+                        log.Fatal("Failed to create indexes: ", err)
+                }
+                if *migrate {
+                        return
+                }
+
+                buoys = storage.NewMongoBuoyStore(client)
+                users = storage.NewMongoUserStore(client)
+                alerts = storage.NewMongoAlertStore(client)
+                webhooks = storage.NewMongoWebhookStore(client)
+                statuses = storage.NewMongoStatusStore(client)
+                drifts = storage.NewMongoDriftStore(client)
+        case "memory":
+                buoys = storage.NewMemoryBuoyStore()
+                users = storage.NewMemoryUserStore()
+                alerts = storage.NewMemoryAlertStore()
+                webhooks = storage.NewMemoryWebhookStore()
+                statuses = storage.NewMemoryStatusStore()
+                drifts = storage.NewMemoryDriftStore()
+        case "bolt":
+                db, err := storage.OpenBolt(*boltPath)
+                if err != nil {
+                        log.Fatal("Failed to open bolt database: ", err)
+                }
+                defer db.Close()
+                if *exportDir != "" {
+                        if err := storage.ExportBolt(db, *exportDir); err != nil {
+                                log.Fatal("Export failed: ", err)
+                        }
+                        fmt.Println("Exported", *boltPath, "to", *exportDir)
+                        return
+                }
+
+                buoys = storage.NewBoltBuoyStore(db)
+                users = storage.NewBoltUserStore(db)
+                alerts = storage.NewBoltAlertStore(db)
+                webhooks = storage.NewBoltWebhookStore(db)
+                statuses = storage.NewBoltStatusStore(db)
+                drifts = storage.NewBoltDriftStore(db)
+        default:
+                log.Fatal("Unknown storage backend: ", *storageKind)
+        }
+
+        loadCtx, cancelLoad := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancelLoad()
+
+        // Background loops stop with the server, and are waited for before
+        // the store is closed
+        var loops sync.WaitGroup
+
+        // The stores are wrapped below by the parts of the server that act
+        // on what is written: webhooks, alerts, drift detection, streams and
+        // buoy status. Each sees every reading once, whichever way it
+        // arrives, whether over HTTP, MQTT or from the simulator, since
+        // duplicates are skipped before they reach it. A wrapper failing to
+        // act logs the error and does not fail the write.
+
+        // New alerts and buoys and deleted buoys are sent to webhooks in the
+        // background
+        dispatcher := webhook.NewDispatcher(webhooks)
+        if err := dispatcher.Load(loadCtx); err != nil {
+                log.Fatal("Failed to load webhooks: ", err)
+        }
+        startLoop(&loops, func() { dispatcher.Run(ctx) })
+        buoys = dispatcher.BuoyStore(buoys)
+        alerts = dispatcher.AlertStore(alerts)
+        statuses = dispatcher.StatusStore(statuses)
+        drifts = dispatcher.DriftStore(drifts)
+
+        // Alert rules are evaluated on every reading stored
+        engine := alerting.NewEngine(alerts)
+        if err := engine.Load(loadCtx); err != nil {
+                log.Fatal("Failed to load alert rules: ", err)
+        }
+        buoys = engine.Store(buoys)
+
+        // Every fix stored is checked against the buoy's anchor
+        detector := drift.NewDetector(drifts, *watchRadius)
+        buoys = detector.Store(buoys)
+        seedAnchors(buoys)
+
+        // Everything stored from here on is sent to clients watching the
+        // buoys
+        hub := stream.NewHub(*streamHistory)
+        buoys = hub.Store(buoys)
+
+        // Buoys are checked for missed reports in the background, and read
+        // with their status
+        monitor := presence.NewMonitor(statuses, *reportInterval)
+        buoys = monitor.Store(buoys)
+        startLoop(&loops, func() { monitor.Run(ctx, buoys) })
+
         router := gin.Default()
 
         router.GET("/", func(c *gin.Context) {
@@ -45,12 +354,79 @@ func main() {
                 })
         })
 
-		// run database
-	configs.ConnectDB()
+	routes.UserRoute(router, users) //add this
+        routes.BuoyRoute(router, buoys)
+        routes.StreamRoute(router, buoys, hub)
+        routes.AlertRoute(router, alerts, engine)
+        routes.WebhookRoute(router, webhooks, dispatcher)
+        routes.StatusRoute(router, statuses)
+        routes.DriftRoute(router, drifts)
+
+        // Buoys on cellular links publish their readings over MQTT
+        if *mqttBroker != "" {
+                if *mqttQoS < 0 || *mqttQoS > 2 {
+                        log.Fatal("-mqtt-qos must be 0, 1 or 2")
+                }
+                username, password := configs.EnvMQTTCredentials()
+                subscriber, err := uplink.NewSubscriber(uplink.Config{
+                        Broker:   *mqttBroker,
+                        ClientID: *mqttClientID,
+                        Username: username,
+                        Password: password,
+                        Topic:    *mqttTopic,
+                        QoS:      byte(*mqttQoS),
+                }, controllers.WavesUplinkSink(buoys))
+                if err != nil {
+                        log.Fatal("Invalid MQTT configuration: ", err)
+                }
+                startLoop(&loops, func() { subscriber.Run(ctx) })
+                routes.UplinkRoute(router, subscriber)
+        }
 
-	routes.UserRoute(router) //add this
-        routes.BuoyRoute(router)
-         go generateAndInsertData("64c1de1bccc77c103ab51ed1", 34.30115, -120.6133) // Replace with the actual buoy ID and initial latitude/longitude
-	// go generateAndInsertData("your-buoy-id-2", your-lat-2, your-long-2) // Repeat this line for other buoys
-        router.Run("localhost:6000") 
-}
\ No newline at end of file
+        // Simulated buoys store their readings the same way as real ones,
+        // and are started, stopped and reconfigured at /admin/simulator
+        simulations := simulator.NewManager(ctx, controllers.SimulatorSink(buoys))
+        simulated, err := simulatedBuoys(*simulate, buoys)
+        if err != nil {
+                log.Fatal("Failed to read simulated buoys: ", err)
+        }
+        var drill simulator.Scenario
+        if *scenarioPath != "" {
+                if drill, err = drillScenario(*scenarioPath, buoys); err != nil {
+                        log.Fatal("Failed to read drill scenario: ", err)
+                }
+                if _, err := simulations.Play(drill); err != nil {
+                        log.Fatal("Invalid drill scenario ", drill.Name, ": ", err)
+                }
+        }
+        for _, config := range simulated {
+                if *scenarioPath != "" && config.BuoyID == drill.Buoy.BuoyID {
+                        continue
+                }
+                if _, err := simulations.Start(config); err != nil {
+                        log.Fatal("Invalid simulated buoy ", config.BuoyID, ": ", err)
+                }
+        }
+        routes.SimulatorRoute(router, buoys, simulations)
+
+        server := &http.Server{Addr: "localhost:6000", Handler: router}
+        go func() {
+                if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                        log.Fatal("Server failed: ", err)
+                }
+        }()
+
+        // On SIGINT or SIGTERM, requests in progress are given time to
+        // finish, and the simulations and background loops stop before the
+        // store is closed
+        <-ctx.Done()
+        stop()
+        fmt.Println("Shutting down")
+        shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancelShutdown()
+        if err := server.Shutdown(shutdownCtx); err != nil {
+                fmt.Println("Failed to shut down the server:", err)
+        }
+        simulations.Wait()
+        loops.Wait()
+}
@@ -0,0 +1,307 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// Buoy documents written before waves had their own collection. Readings
+// are copied as-is; ConvertWaveTimestamps fixes their timestamps afterwards.
+type legacyBuoy struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Waves []bson.M           `bson:"waves"`
+}
+
+// Series collections and the fields that identify a reading in each. A buoy
+// has at most one reading per timestamp, or per payload and timestamp.
+var seriesKeys = []struct {
+	collection string
+	fields     []string
+}{
+	{"waves", []string{"buoyId", "timestamp"}},
+	{"telemetry", []string{"buoyId", "timestamp"}},
+	{"spectra", []string{"buoyId", "timestamp"}},
+	{"observations", []string{"buoyId", "payload", "timestamp"}},
+}
+
+// EnsureIndexes creates the unique (buoyId, timestamp) indexes the waves,
+// telemetry and spectra collections are queried and deduplicated by, the
+// unique (buoyId, payload, timestamp) index of the observations collection
+// the 2dsphere index on buoy positions and the indexes alerts, status
+// events and drift events are listed by. Non-unique indexes created by older versions are replaced.
+func EnsureIndexes(ctx context.Context, client *mongo.Client) error {
+	for _, series := range seriesKeys {
+		keys := bson.D{}
+		for _, field := range series.fields {
+			keys = append(keys, bson.E{Key: field, Value: 1})
+		}
+		if err := ensureUniqueIndex(ctx, configs.GetCollection(client, series.collection), keys); err != nil {
+			return fmt.Errorf("%s: %w", series.collection, err)
+		}
+	}
+
+	buoys := configs.GetCollection(client, "buoys")
+	_, err := buoys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "position", Value: "2dsphere"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	alerts := configs.GetCollection(client, "alerts")
+	_, err = alerts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "buoyId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ruleId", Value: 1}, {Key: "buoyId", Value: 1}, {Key: "timestamp", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"statusEvents", "driftEvents"} {
+		_, err = configs.GetCollection(client, name).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "buoyId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create a unique index, dropping a non-unique one on the same keys first
+func ensureUniqueIndex(ctx context.Context, collection *mongo.Collection, keys bson.D) error {
+	model := mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}
+	_, err := collection.Indexes().CreateOne(ctx, model)
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexOptionsConflict" || cmdErr.Name == "IndexKeySpecsConflict") {
+		var names []string
+		for _, k := range keys {
+			names = append(names, fmt.Sprintf("%s_%v", k.Key, k.Value))
+		}
+		if _, err := collection.Indexes().DropOne(ctx, strings.Join(names, "_")); err != nil {
+			return err
+		}
+		_, err = collection.Indexes().CreateOne(ctx, model)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("duplicate readings prevent creating a unique index, run with -migrate to remove them: %w", err)
+	}
+	return err
+}
+
+// RemoveDuplicateReadings deletes all but the first stored of the readings
+// a buoy has for the same timestamp (and payload, for observations), which
+// older versions accepted. It returns the number of readings removed.
+func RemoveDuplicateReadings(ctx context.Context, client *mongo.Client) (int, error) {
+	removed := 0
+	for _, series := range seriesKeys {
+		collection := configs.GetCollection(client, series.collection)
+
+		key := bson.M{}
+		for _, field := range series.fields {
+			key[field] = "$" + field
+		}
+		pipeline := mongo.Pipeline{
+			{{Key: "$sort", Value: bson.M{"_id": 1}}},
+			{{Key: "$group", Value: bson.M{"_id": key, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+			{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		}
+		results, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			return removed, err
+		}
+
+		for results.Next(ctx) {
+			var group struct {
+				IDs []primitive.ObjectID `bson:"ids"`
+			}
+			if err := results.Decode(&group); err != nil {
+				results.Close(ctx)
+				return removed, err
+			}
+			deleted, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+			if err != nil {
+				results.Close(ctx)
+				return removed, err
+			}
+			removed += int(deleted.DeletedCount)
+		}
+		err = results.Err()
+		results.Close(ctx)
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// SplitEmbeddedWaves moves the waves array embedded in each buoy document
+// into the waves collection and removes it from the buoy. Readings are
+// upserted on (buoyId, timestamp) so an interrupted run can be repeated.
+// It returns the number of buoys migrated.
+func SplitEmbeddedWaves(ctx context.Context, client *mongo.Client) (int, error) {
+	buoys := configs.GetCollection(client, "buoys")
+	waves := configs.GetCollection(client, "waves")
+
+	results, err := buoys.Find(ctx, bson.M{"waves": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close(ctx)
+
+	migrated := 0
+	for results.Next(ctx) {
+		var buoy legacyBuoy
+		if err := results.Decode(&buoy); err != nil {
+			return migrated, err
+		}
+
+		if len(buoy.Waves) > 0 {
+			writes := make([]mongo.WriteModel, 0, len(buoy.Waves))
+			for _, w := range buoy.Waves {
+				w["buoyId"] = buoy.ID
+				writes = append(writes, mongo.NewReplaceOneModel().
+					SetFilter(bson.M{"buoyId": buoy.ID, "timestamp": w["timestamp"]}).
+					SetReplacement(w).
+					SetUpsert(true))
+			}
+			if _, err := waves.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return migrated, err
+			}
+		}
+
+		if _, err := buoys.UpdateOne(ctx, bson.M{"_id": buoy.ID}, bson.M{"$unset": bson.M{"waves": ""}}); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, results.Err()
+}
+
+// ConvertWaveTimestamps rewrites waves readings whose timestamp is still a
+// string as BSON dates. It returns the number of readings converted and the
+// IDs of those whose timestamp could not be parsed, which are left unchanged.
+func ConvertWaveTimestamps(ctx context.Context, client *mongo.Client) (int, []primitive.ObjectID, error) {
+	waves := configs.GetCollection(client, "waves")
+
+	results, err := waves.Find(ctx, bson.M{"timestamp": bson.M{"$type": "string"}})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer results.Close(ctx)
+
+	converted := 0
+	var invalid []primitive.ObjectID
+	for results.Next(ctx) {
+		var reading struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Timestamp string             `bson:"timestamp"`
+		}
+		if err := results.Decode(&reading); err != nil {
+			return converted, invalid, err
+		}
+
+		timestamp, err := models.ParseTimestamp(reading.Timestamp)
+		if err != nil {
+			invalid = append(invalid, reading.ID)
+			continue
+		}
+
+		if _, err := waves.UpdateOne(ctx, bson.M{"_id": reading.ID}, bson.M{"$set": bson.M{"timestamp": timestamp}}); err != nil {
+			return converted, invalid, err
+		}
+		converted++
+	}
+
+	return converted, invalid, results.Err()
+}
+
+// BackfillBuoyPositions sets the last known position of buoys that have none
+// from their latest waves reading. It returns the number of buoys updated.
+func BackfillBuoyPositions(ctx context.Context, client *mongo.Client) (int, error) {
+	buoys := configs.GetCollection(client, "buoys")
+	waves := configs.GetCollection(client, "waves")
+
+	results, err := buoys.Find(ctx, bson.M{"position": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close(ctx)
+
+	updated := 0
+	for results.Next(ctx) {
+		var buoy struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := results.Decode(&buoy); err != nil {
+			return updated, err
+		}
+
+		var latest models.WaveObservation
+		opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+		err := waves.FindOne(ctx, bson.M{"buoyId": buoy.ID, "timestamp": bson.M{"$type": "date"}}, opts).Decode(&latest)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return updated, err
+		}
+
+		update := bson.M{"$set": bson.M{
+			"position":          models.NewGeoPoint(latest.Latitude, latest.Longitude),
+			"positionTimestamp": latest.Timestamp,
+		}}
+		if _, err := buoys.UpdateOne(ctx, bson.M{"_id": buoy.ID}, update); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, results.Err()
+}
+
+// UnsetUnreportedWaveFields removes the values older versions stored as zero
+// for the fields a waves reading did not have, so they read as not reported:
+// periods, spreads and highest waves of zero, which no measurement has, and
+// directions of zero with no spread. It returns the number of values removed.
+func UnsetUnreportedWaveFields(ctx context.Context, client *mongo.Client) (int, error) {
+	waves := configs.GetCollection(client, "waves")
+
+	// Directions go first, while their spreads are still there to tell a
+	// missing direction from a wave coming from due north
+	updates := []struct {
+		filter bson.M
+		field  string
+	}{
+		{bson.M{"peakdirection": 0, "peakdirectionalspread": bson.M{"$in": bson.A{0, nil}}}, "peakdirection"},
+		{bson.M{"meandirection": 0, "meandirectionalspread": bson.M{"$in": bson.A{0, nil}}}, "meandirection"},
+		{bson.M{"peakperiod": 0}, "peakperiod"},
+		{bson.M{"meanperiod": 0}, "meanperiod"},
+		{bson.M{"peakdirectionalspread": 0}, "peakdirectionalspread"},
+		{bson.M{"meandirectionalspread": 0}, "meandirectionalspread"},
+		{bson.M{"maxwaveheight": 0}, "maxwaveheight"},
+	}
+
+	removed := 0
+	for _, update := range updates {
+		result, err := waves.UpdateMany(ctx, update.filter, bson.M{"$unset": bson.M{update.field: ""}})
+		if err != nil {
+			return removed, err
+		}
+		removed += int(result.ModifiedCount)
+	}
+	return removed, nil
+}
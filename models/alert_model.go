@@ -0,0 +1,46 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Alert states
+const (
+	AlertFiring  = "firing"
+	AlertCleared = "cleared"
+)
+
+// AlertRule raises an alert when a reading of a buoy crosses a threshold,
+// such as significantWaveHeight > 4 for 3 consecutive readings. It applies
+// to the buoys in BuoyIDs and those in Group, or to every buoy if both are
+// empty. A firing alert clears once a reading is back past the threshold by
+// Hysteresis.
+type AlertRule struct {
+	ID          primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	Name        string               `json:"name" bson:"name"`
+	Field       string               `json:"field" bson:"field"`
+	Operator    string               `json:"operator" bson:"operator"`
+	Threshold   float64              `json:"threshold" bson:"threshold"`
+	Consecutive int                  `json:"consecutive" bson:"consecutive"`
+	Hysteresis  float64              `json:"hysteresis" bson:"hysteresis"`
+	Severity    string               `json:"severity" bson:"severity"`
+	BuoyIDs     []primitive.ObjectID `json:"buoyIds,omitempty" bson:"buoyIds,omitempty"`
+	Group       string               `json:"group,omitempty" bson:"group,omitempty"`
+	Disabled    bool                 `json:"disabled,omitempty" bson:"disabled,omitempty"`
+}
+
+// Alert records a rule firing or clearing on a buoy. Timestamp is the time
+// of the reading that caused it. Alerts caused by synthetic readings are
+// exercises.
+type Alert struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	RuleID    primitive.ObjectID `json:"ruleId" bson:"ruleId"`
+	RuleName  string             `json:"ruleName" bson:"ruleName"`
+	BuoyID    primitive.ObjectID `json:"buoyId" bson:"buoyId"`
+	Severity  string             `json:"severity" bson:"severity"`
+	State     string             `json:"state" bson:"state"`
+	Field     string             `json:"field" bson:"field"`
+	Value     float64            `json:"value" bson:"value"`
+	Threshold float64            `json:"threshold" bson:"threshold"`
+	Timestamp Timestamp          `json:"timestamp" bson:"timestamp"`
+	CreatedAt Timestamp          `json:"createdAt" bson:"createdAt"`
+	Exercise  bool               `json:"exercise,omitempty" bson:"exercise,omitempty"`
+}
@@ -1,18 +1,43 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WavesData is a waves reading. Values the buoy did not report are left nil.
 type WavesData struct {
 	SignificantWaveHeight   float64 `json:"significantWaveHeight"`
-	PeakPeriod              float64 `json:"peakPeriod"`
-	MeanPeriod              float64 `json:"meanPeriod"`
-	PeakDirection           float64 `json:"peakDirection"`
-	PeakDirectionalSpread   float64 `json:"peakDirectionalSpread"`
-	MeanDirection           float64 `json:"meanDirection"`
-	MeanDirectionalSpread   float64 `json:"meanDirectionalSpread"`
-	Timestamp               string  `json:"timestamp"`
+	PeakPeriod              *float64 `json:"peakPeriod,omitempty" bson:",omitempty"`
+	MeanPeriod              *float64 `json:"meanPeriod,omitempty" bson:",omitempty"`
+	PeakDirection           *float64 `json:"peakDirection,omitempty" bson:",omitempty"`
+	PeakDirectionalSpread   *float64 `json:"peakDirectionalSpread,omitempty" bson:",omitempty"`
+	MeanDirection           *float64 `json:"meanDirection,omitempty" bson:",omitempty"`
+	MeanDirectionalSpread   *float64 `json:"meanDirectionalSpread,omitempty" bson:",omitempty"`
+	MaxWaveHeight           *float64 `json:"maxWaveHeight,omitempty" bson:",omitempty"`
+	Timestamp               Timestamp `json:"timestamp"`
 	Latitude                float64 `json:"latitude"`
 	Longitude               float64 `json:"longitude"`
+	// Generated by the simulator rather than measured
+	Synthetic               bool `json:"synthetic,omitempty" bson:",omitempty"`
+}
+
+// Float64 returns a pointer to v, for the values of a reading that may be
+// left out
+func Float64(v float64) *float64 {
+	return &v
+}
+
+// UnmarshalJSON ignores "synthetic": only the simulator makes synthetic
+// readings, and it stores them without going through JSON.
+func (w *WavesData) UnmarshalJSON(data []byte) error {
+	type plain WavesData
+	if err := json.Unmarshal(data, (*plain)(w)); err != nil {
+		return err
+	}
+	w.Synthetic = false
+	return nil
 }
 
 type Buoy struct {
@@ -20,9 +45,39 @@ type Buoy struct {
 	BuoyName       string             `json:"buoyname,omitempty" validate:"required"`
 	Location       string             `json:"location,omitempty" validate:"required"`
 	PayloadType    string             `json:"payloadType,omitempty" validate:"required"`
+	Payloads       []string           `json:"payloads,omitempty" bson:"payloads,omitempty"`
+	Groups         []string           `json:"groups,omitempty" bson:"groups,omitempty"`
 	BatteryVoltage float64            `json:"batteryVoltage,omitempty"`
 	BatteryPower   float64            `json:"batteryPower,omitempty"`
 	SolarVoltage   float64            `json:"solarVoltage,omitempty"`
 	Humidity       float64            `json:"humidity,omitempty"`
-	Waves          []WavesData        `json:"waves,omitempty"`
+	TelemetryTime  *Timestamp         `json:"telemetryTimestamp,omitempty" bson:"telemetryTimestamp,omitempty"`
+	Position       *GeoPoint          `json:"position,omitempty" bson:"position,omitempty"`
+	PositionTime   *Timestamp         `json:"positionTimestamp,omitempty" bson:"positionTimestamp,omitempty"`
+	LastReportTime *Timestamp         `json:"lastReportTimestamp,omitempty" bson:"lastReportTimestamp,omitempty"`
+	ReportInterval int                `json:"reportInterval,omitempty" bson:"reportInterval,omitempty"`
+	Anchor         *GeoPoint          `json:"anchor,omitempty" bson:"anchor,omitempty"`
+	WatchRadius    float64            `json:"watchRadius,omitempty" bson:"watchRadius,omitempty"`
+	// Used only for exercises, so the simulator may store readings for it
+	Simulated      bool               `json:"simulated,omitempty" bson:"simulated,omitempty"`
+	Status         string             `json:"status,omitempty" bson:"-"`
+	Waves          []WavesData        `json:"waves,omitempty" bson:"-"`
+}
+
+// GeoPoint is a GeoJSON point. Coordinates are longitude then latitude.
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+func NewGeoPoint(latitude, longitude float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{longitude, latitude}}
+}
+
+// WaveObservation is a single WavesData reading stored in its own document
+// in the waves collection, keyed by the buoy it belongs to.
+type WaveObservation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BuoyID    primitive.ObjectID `bson:"buoyId" json:"buoyId"`
+	WavesData `bson:",inline"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Drift states
+const (
+	DriftAdrift   = "adrift"
+	DriftReturned = "returned"
+)
+
+// DriftEvent records a buoy leaving the watch circle around its anchor, or
+// coming back into it. Distance is in meters from the anchor and Bearing in
+// degrees from true north, from the anchor to Position. Timestamp is the time
+// of the fix. Events caused by synthetic fixes are exercises.
+type DriftEvent struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	BuoyID      primitive.ObjectID `json:"buoyId" bson:"buoyId"`
+	State       string             `json:"state" bson:"state"`
+	Distance    float64            `json:"distance" bson:"distance"`
+	Bearing     float64            `json:"bearing" bson:"bearing"`
+	Position    *GeoPoint          `json:"position" bson:"position"`
+	Anchor      *GeoPoint          `json:"anchor" bson:"anchor"`
+	WatchRadius float64            `json:"watchRadius" bson:"watchRadius"`
+	Timestamp   Timestamp          `json:"timestamp" bson:"timestamp"`
+	CreatedAt   Timestamp          `json:"createdAt" bson:"createdAt"`
+	Exercise    bool               `json:"exercise,omitempty" bson:"exercise,omitempty"`
+}
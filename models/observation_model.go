@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Observation is a timestamped reading of one of a buoy's payloads. Values
+// are keyed by the field names of the payload type. In JSON the values sit
+// next to the timestamp, as in {"timestamp": ..., "windSpeed": 5.1}, along
+// with "synthetic": true for readings generated by the simulator. The flag
+// is ignored when decoding, since clients cannot send synthetic readings.
+type Observation struct {
+	Timestamp Timestamp          `bson:"timestamp"`
+	Values    map[string]float64 `bson:"values"`
+	Synthetic bool               `bson:"synthetic,omitempty"`
+}
+
+func (o Observation) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]interface{}, len(o.Values)+2)
+	for name, value := range o.Values {
+		doc[name] = value
+	}
+	doc["timestamp"] = o.Timestamp
+	if o.Synthetic {
+		doc["synthetic"] = true
+	}
+	return json.Marshal(doc)
+}
+
+func (o *Observation) UnmarshalJSON(data []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	o.Timestamp = Timestamp{}
+	o.Synthetic = false
+	o.Values = make(map[string]float64, len(doc))
+	for name, raw := range doc {
+		switch name {
+		case "timestamp":
+			if err := json.Unmarshal(raw, &o.Timestamp); err != nil {
+				return err
+			}
+			continue
+		case "synthetic":
+			continue
+		}
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("%s must be a number", name)
+		}
+		o.Values[name] = value
+	}
+	return nil
+}
+
+// PayloadObservation is an Observation stored in the observations
+// collection, keyed by buoy and payload type.
+type PayloadObservation struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BuoyID      primitive.ObjectID `bson:"buoyId" json:"buoyId"`
+	Payload     string             `bson:"payload" json:"payload"`
+	Observation `bson:",inline"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// WaveSpectrum is a directional wave spectrum as reported by Spotter-class
+// buoys: one value per frequency bin in each slice. A1, B1, A2 and B2 are the
+// normalized directional Fourier coefficients in the mathematical convention
+// (direction waves travel towards, counterclockwise from east). Direction
+// and DirectionalSpread are per-bin values in nautical degrees (direction
+// waves come from, clockwise from north); they are derived from A1 and B1
+// when left out.
+type WaveSpectrum struct {
+	Timestamp         Timestamp `json:"timestamp" bson:"timestamp"`
+	Latitude          float64   `json:"latitude" bson:"latitude"`
+	Longitude         float64   `json:"longitude" bson:"longitude"`
+	Frequency         []float64 `json:"frequency" bson:"frequency"`
+	Bandwidth         []float64 `json:"bandwidth,omitempty" bson:"bandwidth,omitempty"`
+	EnergyDensity     []float64 `json:"energyDensity" bson:"energyDensity"`
+	A1                []float64 `json:"a1" bson:"a1"`
+	B1                []float64 `json:"b1" bson:"b1"`
+	A2                []float64 `json:"a2,omitempty" bson:"a2,omitempty"`
+	B2                []float64 `json:"b2,omitempty" bson:"b2,omitempty"`
+	Direction         []float64 `json:"direction,omitempty" bson:"direction,omitempty"`
+	DirectionalSpread []float64 `json:"directionalSpread,omitempty" bson:"directionalSpread,omitempty"`
+}
+
+// SpectrumObservation is a WaveSpectrum stored in the spectra collection
+type SpectrumObservation struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BuoyID       primitive.ObjectID `bson:"buoyId" json:"buoyId"`
+	WaveSpectrum `bson:",inline"`
+}
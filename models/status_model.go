@@ -0,0 +1,23 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Reporting statuses of a buoy
+const (
+	StatusOnline  = "online"
+	StatusLate    = "late"
+	StatusOffline = "offline"
+)
+
+// StatusEvent records a buoy's reporting status changing. Timestamp is when
+// the change was noticed. Changes of a buoy whose latest report was
+// synthetic are exercises.
+type StatusEvent struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	BuoyID     primitive.ObjectID `json:"buoyId" bson:"buoyId"`
+	Status     string             `json:"status" bson:"status"`
+	Previous   string             `json:"previous" bson:"previous"`
+	LastReport *Timestamp         `json:"lastReportTimestamp,omitempty" bson:"lastReportTimestamp,omitempty"`
+	Timestamp  Timestamp          `json:"timestamp" bson:"timestamp"`
+	Exercise   bool               `json:"exercise,omitempty" bson:"exercise,omitempty"`
+}
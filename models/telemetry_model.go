@@ -0,0 +1,20 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TelemetryRecord is a timestamped housekeeping reading of a buoy. Values
+// the buoy did not report are left nil.
+type TelemetryRecord struct {
+	Timestamp      Timestamp `json:"timestamp" bson:"timestamp"`
+	BatteryVoltage *float64  `json:"batteryVoltage,omitempty" bson:"batteryVoltage,omitempty"`
+	BatteryPower   *float64  `json:"batteryPower,omitempty" bson:"batteryPower,omitempty"`
+	SolarVoltage   *float64  `json:"solarVoltage,omitempty" bson:"solarVoltage,omitempty"`
+	Humidity       *float64  `json:"humidity,omitempty" bson:"humidity,omitempty"`
+}
+
+// TelemetryObservation is a TelemetryRecord stored in the telemetry collection
+type TelemetryObservation struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BuoyID          primitive.ObjectID `bson:"buoyId" json:"buoyId"`
+	TelemetryRecord `bson:",inline"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Timestamp is the time of an observation. It is stored as a BSON date,
+// accepted in JSON as RFC3339 or Unix epoch seconds or milliseconds, and
+// always written to JSON as UTC RFC3339.
+type Timestamp struct {
+	time.Time
+}
+
+// Epoch values above this are taken to be milliseconds (year 5138 in seconds)
+const epochMillisThreshold = 1e11
+
+// Latest epoch accepted, in milliseconds: the end of year 9999, the last
+// time RFC3339 can write
+const maxEpochMillis = 253402300799999
+
+// MaxClockSkew is how far past the server's clock a reading may be
+// timestamped. A reading further ahead would hold the buoy's position and
+// last report time ahead of all the real readings that follow it.
+const MaxClockSkew = time.Hour
+
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t.UTC()}
+}
+
+// ParseTimestamp parses an RFC3339 time or a Unix epoch in seconds or
+// milliseconds, with or without a fractional part. Epochs must be finite,
+// from 1970 to the end of year 9999.
+func ParseTimestamp(value string) (Timestamp, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return NewTimestamp(t), nil
+	}
+
+	epoch, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: expected RFC3339 or Unix epoch", value)
+	}
+	if math.IsNaN(epoch) || epoch < 0 || epoch > maxEpochMillis {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: Unix epoch out of range", value)
+	}
+	if epoch > epochMillisThreshold {
+		return NewTimestamp(time.UnixMilli(int64(epoch))), nil
+	}
+	sec, frac := int64(epoch), epoch-float64(int64(epoch))
+	return NewTimestamp(time.Unix(sec, int64(frac*1e9))), nil
+}
+
+// InFuture reports whether t is more than MaxClockSkew past the server's
+// clock
+func (t Timestamp) InFuture() bool {
+	return t.After(time.Now().Add(MaxClockSkew))
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(time.RFC3339))
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*t = Timestamp{}
+		return nil
+	}
+
+	value := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseTimestamp(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t Timestamp) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(t.UTC())
+}
+
+// Strings are still accepted so records written before timestamps were
+// stored as dates can be read.
+func (t *Timestamp) UnmarshalBSONValue(kind bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: kind, Value: data}
+	switch kind {
+	case bsontype.DateTime:
+		*t = NewTimestamp(raw.Time())
+		return nil
+	case bsontype.String:
+		parsed, err := ParseTimestamp(raw.StringValue())
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	case bsontype.Null:
+		*t = Timestamp{}
+		return nil
+	}
+	return fmt.Errorf("cannot decode BSON %s into a timestamp", kind)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Webhook is a subscription of a URL to events, such as new alerts. Events
+// lists the event types it receives, all of them if empty. Payloads are
+// signed with Secret.
+type Webhook struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	URL       string             `json:"url" bson:"url"`
+	Events    []string           `json:"events,omitempty" bson:"events,omitempty"`
+	Secret    string             `json:"secret,omitempty" bson:"secret"`
+	Disabled  bool               `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	CreatedAt Timestamp          `json:"createdAt" bson:"createdAt"`
+}
+
+// DeadLetter is an event a webhook failed to take after every retry.
+// Payload is the body that was sent, so it can be sent again as it was.
+type DeadLetter struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	WebhookID  primitive.ObjectID `json:"webhookId" bson:"webhookId"`
+	EventID    primitive.ObjectID `json:"eventId" bson:"eventId"`
+	EventType  string             `json:"eventType" bson:"eventType"`
+	Payload    string             `json:"payload" bson:"payload"`
+	Attempts   int                `json:"attempts" bson:"attempts"`
+	LastStatus int                `json:"lastStatus,omitempty" bson:"lastStatus,omitempty"`
+	LastError  string             `json:"lastError" bson:"lastError"`
+	FailedAt   Timestamp          `json:"failedAt" bson:"failedAt"`
+}
@@ -0,0 +1,226 @@
+// Package ndbc reads and writes the column text format of NOAA's National
+// Data Buoy Center realtime2 files (.txt standard meteorological data and
+// .spec spectral wave summaries). See
+// https://www.ndbc.noaa.gov/faq/measdes.shtml
+package ndbc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"od-api/models"
+)
+
+// Marker of a missing value
+const Missing = "MM"
+
+var (
+	ErrNoHeader      = errors.New("ndbc: missing column header line")
+	ErrNoTimeColumns = errors.New("ndbc: header has no YY MM DD hh columns")
+	ErrNoWaveHeight  = errors.New("WVHT is missing")
+)
+
+// Row is a data line of a file, read as waves data. Latitude and longitude
+// are not part of the format and are left zero.
+type Row struct {
+	// Line number in the file, starting at 1
+	Line  int
+	Waves models.WavesData
+	// Why the line could not be read, or ErrNoWaveHeight if it has no wave
+	// measurement
+	Err error
+}
+
+// Columns mapped to waves data, with the sentinel older files use instead
+// of MM
+var waveColumns = []struct {
+	name    string
+	missing float64
+	set     func(*models.WavesData, float64)
+}{
+	{"WVHT", 99, func(w *models.WavesData, v float64) { w.SignificantWaveHeight = v }},
+	{"DPD", 99, func(w *models.WavesData, v float64) { w.PeakPeriod = &v }},
+	{"APD", 99, func(w *models.WavesData, v float64) { w.MeanPeriod = &v }},
+	{"MWD", 999, func(w *models.WavesData, v float64) { w.PeakDirection = &v }},
+}
+
+// ReadWaves reads the data lines of a .txt or .spec file. Columns are found
+// by name in the header, so either layout works, as do historical files with
+// a four digit YYYY column and no minutes. WVHT, DPD, APD and MWD map to the
+// significant wave height, peak period, mean period and peak direction;
+// other columns are ignored. Lines without WVHT have no wave measurement
+// and are returned with ErrNoWaveHeight. Other missing values are left
+// nil.
+func ReadWaves(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	var columns map[string]int
+	var rows []Row
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if columns == nil {
+			// The first line names the columns, the optional second one
+			// starting with # gives their units
+			columns = make(map[string]int, len(fields))
+			for i, name := range fields {
+				columns[strings.TrimPrefix(name, "#")] = i
+			}
+			if _, ok := columns["YY"]; !ok {
+				if _, ok := columns["YYYY"]; !ok {
+					return nil, ErrNoHeader
+				}
+			}
+			for _, name := range []string{"MM", "DD", "hh"} {
+				if _, ok := columns[name]; !ok {
+					return nil, ErrNoTimeColumns
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		row := Row{Line: line}
+		if len(fields) != len(columns) {
+			row.Err = fmt.Errorf("expected %d columns, got %d", len(columns), len(fields))
+			rows = append(rows, row)
+			continue
+		}
+
+		timestamp, err := readTime(columns, fields)
+		if err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		row.Waves.Timestamp = models.NewTimestamp(timestamp)
+
+		for _, c := range waveColumns {
+			i, ok := columns[c.name]
+			if !ok {
+				continue
+			}
+			value, present, err := readValue(fields[i], c.missing)
+			if err != nil {
+				row.Err = fmt.Errorf("invalid %s %q", c.name, fields[i])
+				break
+			}
+			if !present {
+				if c.name == "WVHT" {
+					row.Err = ErrNoWaveHeight
+					break
+				}
+				continue
+			}
+			c.set(&row.Waves, value)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if columns == nil {
+		return nil, ErrNoHeader
+	}
+	return rows, nil
+}
+
+// Read the UTC time of a data line
+func readTime(columns map[string]int, fields []string) (time.Time, error) {
+	yearColumn := "YY"
+	i, ok := columns["YY"]
+	if !ok {
+		i, yearColumn = columns["YYYY"], "YYYY"
+	}
+	year, err := strconv.Atoi(fields[i])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", yearColumn, fields[i])
+	}
+	// The oldest files have two digit years, all of them 19xx
+	if year < 100 {
+		year += 1900
+	}
+
+	parts := []int{0, 0, 0, 0}
+	for j, name := range []string{"MM", "DD", "hh", "mm"} {
+		i, ok := columns[name]
+		if !ok {
+			continue
+		}
+		parts[j], err = strconv.Atoi(fields[i])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s %q", name, fields[i])
+		}
+	}
+	month, day, hour, minute := parts[0], parts[1], parts[2], parts[3]
+	// time.Date would roll days past the end of the month, such as Feb 31,
+	// over to the next one
+	t := time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)
+	if month < 1 || month > 12 || day < 1 || t.Day() != day || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid date %d-%02d-%02d %02d:%02d", year, month, day, hour, minute)
+	}
+	return t, nil
+}
+
+// Read a numeric column, reporting whether it holds a value
+func readValue(field string, missing float64) (float64, bool, error) {
+	if field == Missing {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, errors.New("not a number")
+	}
+	if value == missing {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// Header lines of the standard meteorological .txt layout
+const header = "#YY  MM DD hh mm WDIR WSPD GST  WVHT   DPD   APD MWD   PRES  ATMP  WTMP  DEWP  VIS PTDY  TIDE\n" +
+	"#yr  mo dy hr mn degT m/s  m/s     m   sec   sec degT   hPa  degC  degC  degC  nmi  hPa    ft\n"
+
+// WriteHeader writes the two header lines of the .txt layout
+func WriteHeader(w io.Writer) error {
+	_, err := io.WriteString(w, header)
+	return err
+}
+
+// WriteWaves writes a waves reading as a data line of the .txt layout. The
+// meteorological columns are MM, as are the values the reading does not
+// have. Times are truncated to the minute.
+func WriteWaves(w io.Writer, waves models.WavesData) error {
+	direction := Missing
+	if waves.PeakDirection != nil {
+		direction = strconv.FormatFloat(*waves.PeakDirection, 'f', 0, 64)
+	}
+
+	t := waves.Timestamp.UTC()
+	_, err := fmt.Fprintf(w, "%4d %02d %02d %02d %02d %4s %4s %4s %5.2f %5s %5s %3s %6s %5s %5s %5s %4s %4s %5s\n",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+		Missing, Missing, Missing,
+		waves.SignificantWaveHeight, period(waves.PeakPeriod), period(waves.MeanPeriod), direction,
+		Missing, Missing, Missing, Missing, Missing, Missing, Missing)
+	return err
+}
+
+func period(seconds *float64) string {
+	if seconds == nil {
+		return Missing
+	}
+	return strconv.FormatFloat(*seconds, 'f', 2, 64)
+}
@@ -0,0 +1,347 @@
+// Package netcdf writes files in the netCDF classic format, enough for the
+// API to export time series that scientific tools open directly. See
+// https://docs.unidata.ucar.edu/netcdf-c/current/file_format_specifications.html
+package netcdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Tags and type codes of the classic format
+const (
+	tagDimension = 0x0A
+	tagVariable  = 0x0B
+	tagAttribute = 0x0C
+
+	typeChar   = 2
+	typeInt    = 4
+	typeFloat  = 5
+	typeDouble = 6
+)
+
+// Dimension is a named axis of variables. At most one dimension may be
+// unlimited: its length is the number of records of the variables that use
+// it as their first dimension.
+type Dimension struct {
+	Name      string
+	Length    int
+	Unlimited bool
+}
+
+// Attribute is a named value of a variable or of the file. Value is a
+// string, an int32, a float32, a float64 or a slice of one of the numbers.
+type Attribute struct {
+	Name  string
+	Value interface{}
+}
+
+// Variable holds an array along named dimensions. Data is a string, or a
+// []int32, []float32 or []float64, with the values in row-major order.
+type Variable struct {
+	Name       string
+	Dimensions []string
+	Attributes []Attribute
+	Data       interface{}
+}
+
+// File is a netCDF dataset
+type File struct {
+	Dimensions []Dimension
+	Attributes []Attribute
+	Variables  []Variable
+}
+
+// Resolved layout of a variable in the file
+type layout struct {
+	dims   []int
+	record bool
+	typ    int32
+	// Number of values in the variable, or in one record of it
+	count int
+	size  int64
+	begin int64
+}
+
+// WriteTo encodes the file. The 64-bit offset variant of the format is used
+// when the data does not fit the 2 GiB the original one can address.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	dimIDs := make(map[string]int, len(f.Dimensions))
+	numRecs := -1
+	for i, d := range f.Dimensions {
+		dimIDs[d.Name] = i
+	}
+
+	layouts := make([]layout, len(f.Variables))
+	for i, v := range f.Variables {
+		l := &layouts[i]
+		typ, values, width, err := dataType(v.Data)
+		if err != nil {
+			return 0, fmt.Errorf("netcdf: variable %s: %w", v.Name, err)
+		}
+		l.typ = typ
+
+		l.count = 1
+		for j, name := range v.Dimensions {
+			id, ok := dimIDs[name]
+			if !ok {
+				return 0, fmt.Errorf("netcdf: variable %s: unknown dimension %s", v.Name, name)
+			}
+			l.dims = append(l.dims, id)
+			d := f.Dimensions[id]
+			if d.Unlimited {
+				if j != 0 {
+					return 0, fmt.Errorf("netcdf: variable %s: the unlimited dimension must come first", v.Name)
+				}
+				l.record = true
+				continue
+			}
+			l.count *= d.Length
+		}
+
+		if l.record {
+			if l.count == 0 || values%l.count != 0 {
+				return 0, fmt.Errorf("netcdf: variable %s: %d values do not fill whole records", v.Name, values)
+			}
+			records := values / l.count
+			if numRecs >= 0 && records != numRecs {
+				return 0, fmt.Errorf("netcdf: variable %s has %d records, others have %d", v.Name, records, numRecs)
+			}
+			numRecs = records
+		} else if values != l.count {
+			return 0, fmt.Errorf("netcdf: variable %s: expected %d values, got %d", v.Name, l.count, values)
+		}
+		l.size = int64(l.count * width)
+		if !l.record {
+			l.size = pad(l.size)
+		}
+	}
+	if numRecs < 0 {
+		numRecs = 0
+	}
+
+	// Record variables are interleaved record by record, each padded to 4
+	// bytes unless it is the only one
+	recordVars := 0
+	for _, l := range layouts {
+		if l.record {
+			recordVars++
+		}
+	}
+	var recordSize int64
+	for i := range layouts {
+		if layouts[i].record {
+			if recordVars > 1 {
+				layouts[i].size = pad(layouts[i].size)
+			}
+			recordSize += layouts[i].size
+		}
+	}
+
+	// The header length does not depend on the offsets, only on their width
+	version := byte(1)
+	header := f.header(layouts, numRecs, version)
+	total := int64(len(header)) + recordSize*int64(numRecs)
+	for _, l := range layouts {
+		if !l.record {
+			total += l.size
+		}
+	}
+	if total > math.MaxInt32 {
+		version = 2
+		header = f.header(layouts, numRecs, version)
+	}
+
+	offset := int64(len(header))
+	for i := range layouts {
+		if !layouts[i].record {
+			layouts[i].begin = offset
+			offset += layouts[i].size
+		}
+	}
+	for i := range layouts {
+		if layouts[i].record {
+			layouts[i].begin = offset
+			offset += layouts[i].size
+		}
+	}
+	header = f.header(layouts, numRecs, version)
+
+	buffered := bufio.NewWriter(w)
+	out := &countingWriter{w: buffered}
+	out.Write(header)
+	for i, v := range f.Variables {
+		if !layouts[i].record {
+			writeValues(out, v.Data, 0, layouts[i].count, layouts[i].size)
+		}
+	}
+	for r := 0; r < numRecs; r++ {
+		for i, v := range f.Variables {
+			l := layouts[i]
+			if l.record {
+				writeValues(out, v.Data, r*l.count, l.count, l.size)
+			}
+		}
+	}
+	if out.err != nil {
+		return out.n, out.err
+	}
+	return out.n, buffered.Flush()
+}
+
+func (f *File) header(layouts []layout, numRecs int, version byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{'C', 'D', 'F', version})
+	putInt(&b, int32(numRecs))
+
+	if len(f.Dimensions) == 0 {
+		putInt(&b, 0)
+		putInt(&b, 0)
+	} else {
+		putInt(&b, tagDimension)
+		putInt(&b, int32(len(f.Dimensions)))
+		for _, d := range f.Dimensions {
+			putName(&b, d.Name)
+			if d.Unlimited {
+				putInt(&b, 0)
+			} else {
+				putInt(&b, int32(d.Length))
+			}
+		}
+	}
+
+	putAttributes(&b, f.Attributes)
+
+	if len(f.Variables) == 0 {
+		putInt(&b, 0)
+		putInt(&b, 0)
+		return b.Bytes()
+	}
+	putInt(&b, tagVariable)
+	putInt(&b, int32(len(f.Variables)))
+	for i, v := range f.Variables {
+		l := layouts[i]
+		putName(&b, v.Name)
+		putInt(&b, int32(len(l.dims)))
+		for _, id := range l.dims {
+			putInt(&b, int32(id))
+		}
+		putAttributes(&b, v.Attributes)
+		putInt(&b, l.typ)
+		// vsize saturates for variables too large to describe
+		if l.size > math.MaxInt32 {
+			putInt(&b, -1)
+		} else {
+			putInt(&b, int32(l.size))
+		}
+		if version == 1 {
+			putInt(&b, int32(l.begin))
+		} else {
+			binary.Write(&b, binary.BigEndian, l.begin)
+		}
+	}
+	return b.Bytes()
+}
+
+func putAttributes(b *bytes.Buffer, attributes []Attribute) {
+	if len(attributes) == 0 {
+		putInt(b, 0)
+		putInt(b, 0)
+		return
+	}
+	putInt(b, tagAttribute)
+	putInt(b, int32(len(attributes)))
+	for _, a := range attributes {
+		putName(b, a.Name)
+		value := a.Value
+		switch v := value.(type) {
+		case int32:
+			value = []int32{v}
+		case float32:
+			value = []float32{v}
+		case float64:
+			value = []float64{v}
+		}
+		typ, count, width, err := dataType(value)
+		if err != nil {
+			// Attributes are built by the caller, so this is a programming error
+			panic(fmt.Sprintf("netcdf: attribute %s: %v", a.Name, err))
+		}
+		putInt(b, typ)
+		putInt(b, int32(count))
+		writeValues(b, value, 0, count, pad(int64(count*width)))
+	}
+}
+
+// Classify data, returning its type code, number of values and value width
+func dataType(data interface{}) (int32, int, int, error) {
+	switch d := data.(type) {
+	case string:
+		return typeChar, len(d), 1, nil
+	case []int32:
+		return typeInt, len(d), 4, nil
+	case []float32:
+		return typeFloat, len(d), 4, nil
+	case []float64:
+		return typeDouble, len(d), 8, nil
+	}
+	return 0, 0, 0, fmt.Errorf("unsupported data type %T", data)
+}
+
+// Write count values from start, zero padded to size bytes
+func writeValues(w io.Writer, data interface{}, start, count int, size int64) {
+	var written int64
+	switch d := data.(type) {
+	case string:
+		io.WriteString(w, d[start:start+count])
+		written = int64(count)
+	case []int32:
+		binary.Write(w, binary.BigEndian, d[start:start+count])
+		written = int64(count) * 4
+	case []float32:
+		binary.Write(w, binary.BigEndian, d[start:start+count])
+		written = int64(count) * 4
+	case []float64:
+		binary.Write(w, binary.BigEndian, d[start:start+count])
+		written = int64(count) * 8
+	}
+	if size > written {
+		w.Write(make([]byte, size-written))
+	}
+}
+
+func putInt(b *bytes.Buffer, v int32) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func putName(b *bytes.Buffer, name string) {
+	putInt(b, int32(len(name)))
+	b.WriteString(name)
+	b.Write(make([]byte, pad(int64(len(name)))-int64(len(name))))
+}
+
+// Round up to a multiple of 4 bytes
+func pad(n int64) int64 {
+	return (n + 3) &^ 3
+}
+
+// Keeps the first error and the number of bytes written
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
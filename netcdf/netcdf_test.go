@@ -0,0 +1,412 @@
+package netcdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// A netCDF classic file as read back, independently of the writer
+type decoded struct {
+	version    byte
+	numRecs    int
+	dimensions []Dimension
+	attributes []Attribute
+	variables  []Variable
+}
+
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		if r.err == nil {
+			r.err = fmt.Errorf("truncated at %d reading %d bytes", r.pos, n)
+		}
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) int32() int32 {
+	return int32(binary.BigEndian.Uint32(r.bytes(4)))
+}
+
+func (r *reader) name() string {
+	n := int(r.int32())
+	name := string(r.bytes(n))
+	r.bytes(int(pad(int64(n))) - n)
+	return name
+}
+
+// Read count values of a type at the current position
+func (r *reader) values(typ int32, count int) interface{} {
+	switch typ {
+	case typeChar:
+		return string(r.bytes(count))
+	case typeInt:
+		v := make([]int32, count)
+		for i := range v {
+			v[i] = r.int32()
+		}
+		return v
+	case typeFloat:
+		v := make([]float32, count)
+		for i := range v {
+			v[i] = math.Float32frombits(binary.BigEndian.Uint32(r.bytes(4)))
+		}
+		return v
+	case typeDouble:
+		v := make([]float64, count)
+		for i := range v {
+			v[i] = math.Float64frombits(binary.BigEndian.Uint64(r.bytes(8)))
+		}
+		return v
+	}
+	r.err = fmt.Errorf("unknown type %d", typ)
+	return nil
+}
+
+func (r *reader) attributes() []Attribute {
+	tag, n := r.int32(), int(r.int32())
+	if tag == 0 && n == 0 {
+		return nil
+	}
+	if tag != tagAttribute {
+		r.err = fmt.Errorf("expected attribute tag, got %d", tag)
+		return nil
+	}
+	attributes := make([]Attribute, n)
+	for i := range attributes {
+		attributes[i].Name = r.name()
+		typ, count := r.int32(), int(r.int32())
+		start := r.pos
+		attributes[i].Value = r.values(typ, count)
+		r.pos = start + int(pad(int64(r.pos-start)))
+	}
+	return attributes
+}
+
+func decode(data []byte) (*decoded, error) {
+	r := &reader{data: data}
+	magic := r.bytes(4)
+	if string(magic[:3]) != "CDF" || (magic[3] != 1 && magic[3] != 2) {
+		return nil, fmt.Errorf("bad magic %q", magic)
+	}
+	f := &decoded{version: magic[3], numRecs: int(r.int32())}
+
+	tag, n := r.int32(), int(r.int32())
+	if tag != 0 && tag != tagDimension {
+		return nil, fmt.Errorf("expected dimension tag, got %d", tag)
+	}
+	for i := 0; i < n; i++ {
+		d := Dimension{Name: r.name(), Length: int(r.int32())}
+		d.Unlimited = d.Length == 0
+		f.dimensions = append(f.dimensions, d)
+	}
+	f.attributes = r.attributes()
+
+	type header struct {
+		dims  []int
+		typ   int32
+		vsize int64
+		begin int64
+	}
+	tag, n = r.int32(), int(r.int32())
+	if tag != 0 && tag != tagVariable {
+		return nil, fmt.Errorf("expected variable tag, got %d", tag)
+	}
+	headers := make([]header, n)
+	for i := 0; i < n; i++ {
+		v := Variable{Name: r.name()}
+		h := &headers[i]
+		ndims := int(r.int32())
+		for j := 0; j < ndims; j++ {
+			id := int(r.int32())
+			h.dims = append(h.dims, id)
+			v.Dimensions = append(v.Dimensions, f.dimensions[id].Name)
+		}
+		v.Attributes = r.attributes()
+		h.typ = r.int32()
+		h.vsize = int64(r.int32())
+		if f.version == 1 {
+			h.begin = int64(r.int32())
+		} else {
+			h.begin = int64(binary.BigEndian.Uint64(r.bytes(8)))
+		}
+		f.variables = append(f.variables, v)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// The layout is worked out from the specification and checked against
+	// the header: non-record variables follow the header in order, each
+	// padded to 4 bytes, then come the records, in which each variable is
+	// padded unless it is the only record variable
+	counts := make([]int, n)
+	records := make([]bool, n)
+	recordVars := 0
+	for i, h := range headers {
+		counts[i] = 1
+		for j, id := range h.dims {
+			if j == 0 && f.dimensions[id].Unlimited {
+				records[i] = true
+				continue
+			}
+			counts[i] *= f.dimensions[id].Length
+		}
+		if records[i] {
+			recordVars++
+		}
+	}
+	widths := map[int32]int64{typeChar: 1, typeInt: 4, typeFloat: 4, typeDouble: 8}
+	offset := int64(r.pos)
+	var recordSize int64
+	for _, record := range []bool{false, true} {
+		for i, h := range headers {
+			if records[i] != record {
+				continue
+			}
+			size := int64(counts[i]) * widths[h.typ]
+			if !record || recordVars > 1 {
+				size = pad(size)
+			}
+			if h.vsize != size || h.begin != offset {
+				return nil, fmt.Errorf("variable %s has vsize %d and begin %d, want %d and %d", f.variables[i].Name, h.vsize, h.begin, size, offset)
+			}
+			offset += size
+			if record {
+				recordSize += size
+			}
+		}
+	}
+	if want := offset + recordSize*int64(f.numRecs-1); f.numRecs > 0 && int64(len(data)) != want {
+		return nil, fmt.Errorf("file is %d bytes, want %d", len(data), want)
+	}
+
+	for i, h := range headers {
+		count, record := counts[i], records[i]
+		if !record {
+			r.pos = int(h.begin)
+			f.variables[i].Data = r.values(h.typ, count)
+			continue
+		}
+
+		// Record variables are read record by record and joined
+		var joined interface{}
+		for rec := 0; rec < f.numRecs; rec++ {
+			r.pos = int(h.begin + int64(rec)*recordSize)
+			joined = appendValues(joined, r.values(h.typ, count))
+		}
+		if joined == nil {
+			joined = r.values(h.typ, 0)
+		}
+		f.variables[i].Data = joined
+	}
+	return f, r.err
+}
+
+func appendValues(a, b interface{}) interface{} {
+	if a == nil {
+		return b
+	}
+	switch b := b.(type) {
+	case string:
+		return a.(string) + b
+	case []int32:
+		return append(a.([]int32), b...)
+	case []float32:
+		return append(a.([]float32), b...)
+	case []float64:
+		return append(a.([]float64), b...)
+	}
+	return nil
+}
+
+func encode(t *testing.T, f *File) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+	return buf.Bytes()
+}
+
+// Compare values, taking NaNs as equal
+func sameValues(a, b interface{}) bool {
+	x, ok := a.([]float64)
+	y, ok2 := b.([]float64)
+	if !ok || !ok2 {
+		return reflect.DeepEqual(a, b)
+	}
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] && !(math.IsNaN(x[i]) && math.IsNaN(y[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	nan := math.NaN()
+	f := &File{
+		Dimensions: []Dimension{
+			{Name: "time", Unlimited: true},
+			{Name: "name_strlen", Length: 5},
+			{Name: "band", Length: 3},
+		},
+		Attributes: []Attribute{
+			{Name: "Conventions", Value: "CF-1.8"},
+			{Name: "count", Value: int32(7)},
+			{Name: "lat_min", Value: 34.5},
+			{Name: "flags", Value: []int32{0, 1}},
+			{Name: "scale", Value: []float32{0.5, 2}},
+		},
+		Variables: []Variable{
+			{Name: "trajectory", Dimensions: []string{"name_strlen"}, Data: "buoy1"},
+			{Name: "weights", Dimensions: []string{"band"}, Data: []float32{0.25, 0.5, 0.25}},
+			{Name: "time", Dimensions: []string{"time"}, Data: []float64{0, 60, 120, 180}, Attributes: []Attribute{
+				{Name: "units", Value: "seconds since 1970-01-01T00:00:00Z"},
+			}},
+			{Name: "height", Dimensions: []string{"time"}, Data: []float64{1.5, nan, 2.25, nan}, Attributes: []Attribute{
+				{Name: "_FillValue", Value: nan},
+			}},
+			// Narrower than a record's padding, and two values per record
+			{Name: "flag", Dimensions: []string{"time"}, Data: []int32{0, 1, 1, 0}},
+			{Name: "code", Dimensions: []string{"time", "band"}, Data: "abcdefghijkl"},
+		},
+	}
+
+	got, err := decode(encode(t, f))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.version != 1 {
+		t.Errorf("version = %d, want 1", got.version)
+	}
+	if got.numRecs != 4 {
+		t.Errorf("numRecs = %d, want 4", got.numRecs)
+	}
+	if !reflect.DeepEqual(got.dimensions, f.Dimensions) {
+		t.Errorf("dimensions = %+v, want %+v", got.dimensions, f.Dimensions)
+	}
+
+	// Scalar attributes come back as one-value slices
+	wantAttributes := []Attribute{
+		{Name: "Conventions", Value: "CF-1.8"},
+		{Name: "count", Value: []int32{7}},
+		{Name: "lat_min", Value: []float64{34.5}},
+		{Name: "flags", Value: []int32{0, 1}},
+		{Name: "scale", Value: []float32{0.5, 2}},
+	}
+	if !reflect.DeepEqual(got.attributes, wantAttributes) {
+		t.Errorf("attributes = %+v, want %+v", got.attributes, wantAttributes)
+	}
+
+	if len(got.variables) != len(f.Variables) {
+		t.Fatalf("got %d variables, want %d", len(got.variables), len(f.Variables))
+	}
+	for i, want := range f.Variables {
+		v := got.variables[i]
+		if v.Name != want.Name || !reflect.DeepEqual(v.Dimensions, want.Dimensions) {
+			t.Errorf("variable %d = %s%v, want %s%v", i, v.Name, v.Dimensions, want.Name, want.Dimensions)
+		}
+		if !sameValues(v.Data, want.Data) {
+			t.Errorf("variable %s data = %v, want %v", want.Name, v.Data, want.Data)
+		}
+	}
+
+	fill := got.variables[3].Attributes[0]
+	if values, ok := fill.Value.([]float64); fill.Name != "_FillValue" || !ok || len(values) != 1 || !math.IsNaN(values[0]) {
+		t.Errorf("height _FillValue = %+v, want NaN", fill)
+	}
+}
+
+func TestRoundTripNoRecords(t *testing.T) {
+	f := &File{
+		Dimensions: []Dimension{{Name: "time", Unlimited: true}},
+		Variables: []Variable{
+			{Name: "time", Dimensions: []string{"time"}, Data: []float64{}},
+			{Name: "flag", Dimensions: []string{"time"}, Data: []int32{}},
+		},
+	}
+	data := encode(t, f)
+	got, err := decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.numRecs != 0 || got.attributes != nil {
+		t.Errorf("numRecs = %d, attributes = %v, want 0 and none", got.numRecs, got.attributes)
+	}
+	if !reflect.DeepEqual(got.variables[0].Data, []float64{}) || !reflect.DeepEqual(got.variables[1].Data, []int32{}) {
+		t.Errorf("data = %v, %v, want empty", got.variables[0].Data, got.variables[1].Data)
+	}
+}
+
+// A single record variable is not padded between records
+func TestRoundTripSingleRecordVariable(t *testing.T) {
+	f := &File{
+		Dimensions: []Dimension{{Name: "time", Unlimited: true}},
+		Variables:  []Variable{{Name: "code", Dimensions: []string{"time"}, Data: "abc"}},
+	}
+	got, err := decode(encode(t, f))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.variables[0].Data != "abc" {
+		t.Errorf("data = %q, want %q", got.variables[0].Data, "abc")
+	}
+}
+
+func TestWriteToErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file File
+	}{
+		{"unknown dimension", File{
+			Variables: []Variable{{Name: "x", Dimensions: []string{"missing"}, Data: []float64{1}}},
+		}},
+		{"unsupported type", File{
+			Dimensions: []Dimension{{Name: "n", Length: 1}},
+			Variables:  []Variable{{Name: "x", Dimensions: []string{"n"}, Data: []int64{1}}},
+		}},
+		{"wrong length", File{
+			Dimensions: []Dimension{{Name: "n", Length: 2}},
+			Variables:  []Variable{{Name: "x", Dimensions: []string{"n"}, Data: []float64{1}}},
+		}},
+		{"record counts differ", File{
+			Dimensions: []Dimension{{Name: "time", Unlimited: true}},
+			Variables: []Variable{
+				{Name: "a", Dimensions: []string{"time"}, Data: []float64{1, 2}},
+				{Name: "b", Dimensions: []string{"time"}, Data: []float64{1}},
+			},
+		}},
+		{"unlimited dimension not first", File{
+			Dimensions: []Dimension{{Name: "n", Length: 1}, {Name: "time", Unlimited: true}},
+			Variables:  []Variable{{Name: "x", Dimensions: []string{"n", "time"}, Data: []float64{1}}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.file.WriteTo(&bytes.Buffer{}); err == nil {
+				t.Error("WriteTo succeeded, want an error")
+			}
+		})
+	}
+}
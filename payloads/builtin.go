@@ -0,0 +1,69 @@
+package payloads
+
+func init() {
+	Register(&Payload{
+		Name:        "waves",
+		Description: "Bulk wave parameters and the position they were measured at",
+		Fields: []Field{
+			{Name: "significantWaveHeight", Unit: "m", Min: 0, Max: 30, Required: true},
+			{Name: "peakPeriod", Unit: "s", Min: 0, Max: 40},
+			{Name: "meanPeriod", Unit: "s", Min: 0, Max: 40},
+			{Name: "peakDirection", Unit: "deg", Min: 0, Max: 360, Circular: true},
+			{Name: "peakDirectionalSpread", Unit: "deg", Min: 0, Max: 180},
+			{Name: "meanDirection", Unit: "deg", Min: 0, Max: 360, Circular: true},
+			{Name: "meanDirectionalSpread", Unit: "deg", Min: 0, Max: 180},
+			{Name: "maxWaveHeight", Unit: "m", Min: 0, Max: 60},
+			{Name: "latitude", Unit: "deg", Min: -90, Max: 90, Required: true},
+			{Name: "longitude", Unit: "deg", Min: -180, Max: 180, Required: true},
+		},
+		store: storeWaves,
+		query: queryWaves,
+	})
+
+	Register(&Payload{
+		Name:        "wind",
+		Description: "Wind speed and the direction it blows from",
+		Fields: []Field{
+			{Name: "windSpeed", Unit: "m/s", Min: 0, Max: 100, Required: true},
+			{Name: "windDirection", Unit: "deg", Min: 0, Max: 360, Required: true, Circular: true},
+			{Name: "windGust", Unit: "m/s", Min: 0, Max: 150},
+			{Name: "sensorHeight", Unit: "m", Min: 0, Max: 100},
+		},
+	})
+
+	Register(&Payload{
+		Name:        "sst",
+		Description: "Sea surface temperature",
+		Fields: []Field{
+			{Name: "seaSurfaceTemperature", Unit: "degC", Min: -5, Max: 45, Required: true},
+			{Name: "sensorDepth", Unit: "m", Min: 0, Max: 100},
+		},
+	})
+
+	Register(&Payload{
+		Name:        "waterlevel",
+		Description: "Water level relative to the station datum",
+		Fields: []Field{
+			{Name: "waterLevel", Unit: "m", Min: -20, Max: 20, Required: true},
+		},
+	})
+
+	Register(&Payload{
+		Name:        "currents",
+		Description: "Current speed and the direction it flows towards",
+		Fields: []Field{
+			{Name: "currentSpeed", Unit: "m/s", Min: 0, Max: 10, Required: true},
+			{Name: "currentDirection", Unit: "deg", Min: 0, Max: 360, Required: true, Circular: true},
+			{Name: "depth", Unit: "m", Min: 0, Max: 6000},
+		},
+	})
+
+	Register(&Payload{
+		Name:        "pressure",
+		Description: "Barometric pressure at sea level",
+		Fields: []Field{
+			{Name: "pressure", Unit: "hPa", Min: 850, Max: 1100, Required: true},
+			{Name: "pressureTendency", Unit: "hPa", Min: -50, Max: 50},
+		},
+	})
+}
@@ -0,0 +1,150 @@
+// Package payloads defines the kinds of measurement a buoy can carry: the
+// fields of each payload type, how its readings are validated and where they
+// are stored.
+package payloads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+var (
+	ErrMissingTimestamp = errors.New("observation timestamp is required")
+	ErrFutureTimestamp  = errors.New("observation timestamp is in the future")
+)
+
+// Field is a numeric value of a payload's readings
+type Field struct {
+	Name     string  `json:"name"`
+	Unit     string  `json:"unit"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Required bool    `json:"required"`
+	// Angles in degrees, which are averaged as such
+	Circular bool `json:"circular,omitempty"`
+}
+
+// Payload is a registered payload type
+type Payload struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Fields      []Field `json:"fields"`
+
+	// Storage of payloads that keep their own collection. When nil,
+	// readings are stored as generic observations.
+	store func(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, observations []models.Observation) ([]bool, error)
+	query func(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, query storage.RangeQuery) ([]models.PayloadObservation, error)
+}
+
+var registry = map[string]*Payload{}
+
+// Register adds a payload type. It panics if the name is already taken.
+func Register(p *Payload) {
+	if _, ok := registry[p.Name]; ok {
+		panic("payloads: payload type registered twice: " + p.Name)
+	}
+	registry[p.Name] = p
+}
+
+// Lookup returns the payload type registered under a name
+func Lookup(name string) (*Payload, bool) {
+	p, ok := registry[name]
+	return p, ok
+}
+
+// All lists the registered payload types by name
+func All() []*Payload {
+	all := make([]*Payload, 0, len(registry))
+	for _, p := range registry {
+		all = append(all, p)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// CheckNames returns an error naming the first unregistered payload type
+func CheckNames(names []string) error {
+	for _, name := range names {
+		if _, ok := registry[name]; !ok {
+			return fmt.Errorf("unknown payload type %q", name)
+		}
+	}
+	return nil
+}
+
+// Declared lists the payloads a buoy carries. Buoys that predate the
+// payloads list carry their payload type, if it is a registered one.
+func Declared(buoy models.Buoy) []string {
+	if len(buoy.Payloads) > 0 {
+		return buoy.Payloads
+	}
+	if _, ok := registry[buoy.PayloadType]; ok {
+		return []string{buoy.PayloadType}
+	}
+	return nil
+}
+
+// Carries reports whether a buoy declares a payload
+func Carries(buoy models.Buoy, name string) bool {
+	for _, declared := range Declared(buoy) {
+		if declared == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a reading against the payload's fields
+func (p *Payload) Validate(o models.Observation) error {
+	if o.Timestamp.IsZero() {
+		return ErrMissingTimestamp
+	}
+	if o.Timestamp.InFuture() {
+		return ErrFutureTimestamp
+	}
+
+	known := make(map[string]bool, len(p.Fields))
+	for _, f := range p.Fields {
+		known[f.Name] = true
+		value, ok := o.Values[f.Name]
+		if !ok {
+			if f.Required {
+				return fmt.Errorf("%s is required", f.Name)
+			}
+			continue
+		}
+		if value < f.Min || value > f.Max {
+			return fmt.Errorf("%s must be between %g and %g %s", f.Name, f.Min, f.Max, f.Unit)
+		}
+	}
+	for name := range o.Values {
+		if !known[name] {
+			return fmt.Errorf("%s is not a field of the %s payload", name, p.Name)
+		}
+	}
+	return nil
+}
+
+// Store saves validated readings of the payload for a buoy, skipping those
+// at a time the buoy already has a reading for, and reports which were
+// skipped as duplicates
+func (p *Payload) Store(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, observations ...models.Observation) ([]bool, error) {
+	if p.store != nil {
+		return p.store(ctx, buoys, id, observations)
+	}
+	return buoys.AddObservations(ctx, id, p.Name, observations...)
+}
+
+// Query returns a buoy's readings of the payload, oldest first
+func (p *Payload) Query(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, query storage.RangeQuery) ([]models.PayloadObservation, error) {
+	if p.query != nil {
+		return p.query(ctx, buoys, id, query)
+	}
+	return buoys.QueryObservations(ctx, id, p.Name, query)
+}
@@ -0,0 +1,87 @@
+package payloads
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// Waves readings keep their own collection, which also maintains the buoy's
+// last known position
+
+func storeWaves(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, observations []models.Observation) ([]bool, error) {
+	waves := make([]models.WavesData, len(observations))
+	for i, o := range observations {
+		// Fields the observation leaves out are left nil
+		optional := func(name string) *float64 {
+			if v, ok := o.Values[name]; ok {
+				return &v
+			}
+			return nil
+		}
+		waves[i] = models.WavesData{
+			SignificantWaveHeight: o.Values["significantWaveHeight"],
+			PeakPeriod:            optional("peakPeriod"),
+			MeanPeriod:            optional("meanPeriod"),
+			PeakDirection:         optional("peakDirection"),
+			PeakDirectionalSpread: optional("peakDirectionalSpread"),
+			MeanDirection:         optional("meanDirection"),
+			MeanDirectionalSpread: optional("meanDirectionalSpread"),
+			MaxWaveHeight:         optional("maxWaveHeight"),
+			Timestamp:             o.Timestamp,
+			Latitude:              o.Values["latitude"],
+			Longitude:             o.Values["longitude"],
+			Synthetic:             o.Synthetic,
+		}
+	}
+	return buoys.AddWaves(ctx, id, waves...)
+}
+
+// WavesObservation returns a waves reading as an observation of the waves
+// payload, without the values the buoy did not report
+func WavesObservation(w models.WavesData) models.Observation {
+	o := models.Observation{
+		Timestamp: w.Timestamp,
+		Synthetic: w.Synthetic,
+		Values: map[string]float64{
+			"significantWaveHeight": w.SignificantWaveHeight,
+			"latitude":              w.Latitude,
+			"longitude":             w.Longitude,
+		},
+	}
+	optional := map[string]*float64{
+		"peakPeriod":            w.PeakPeriod,
+		"meanPeriod":            w.MeanPeriod,
+		"peakDirection":         w.PeakDirection,
+		"peakDirectionalSpread": w.PeakDirectionalSpread,
+		"meanDirection":         w.MeanDirection,
+		"meanDirectionalSpread": w.MeanDirectionalSpread,
+		"maxWaveHeight":         w.MaxWaveHeight,
+	}
+	for name, value := range optional {
+		if value != nil {
+			o.Values[name] = *value
+		}
+	}
+	return o
+}
+
+func queryWaves(ctx context.Context, buoys storage.BuoyStore, id primitive.ObjectID, query storage.RangeQuery) ([]models.PayloadObservation, error) {
+	waves, err := buoys.QueryWaves(ctx, id, query)
+	if err != nil {
+		return nil, err
+	}
+
+	observations := make([]models.PayloadObservation, len(waves))
+	for i, w := range waves {
+		observations[i] = models.PayloadObservation{
+			ID:          w.ID,
+			BuoyID:      w.BuoyID,
+			Payload:     "waves",
+			Observation: WavesObservation(w.WavesData),
+		}
+	}
+	return observations, nil
+}
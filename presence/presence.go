@@ -0,0 +1,374 @@
+// Package presence works out whether buoys are reporting when expected, from
+// the time of their latest reading, and records each change of their
+// status.
+package presence
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// A buoy is late once it has not reported for lateAfter times its report
+// interval, and offline after offlineAfter times. The margin before late
+// keeps a buoy that reports a little behind its interval from flapping.
+const (
+	lateAfter    = 1.5
+	offlineAfter = 3
+	// Time between checks of every buoy's status
+	checkEvery = 30 * time.Second
+)
+
+// The latest report of a buoy. Buoys stored before the last report time was
+// kept fall back to their latest telemetry or position.
+func lastReport(buoy models.Buoy) *models.Timestamp {
+	last := buoy.LastReportTime
+	for _, t := range []*models.Timestamp{buoy.TelemetryTime, buoy.PositionTime} {
+		if t != nil && (last == nil || t.After(last.Time)) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Where the monitor stands on a buoy
+type buoyState struct {
+	status string
+	// Latest report seen, so a buoy read before a newer report is not
+	// taken for late
+	last time.Time
+	// Whether the latest report was synthetic, making the buoy's status
+	// changes exercises
+	exercise bool
+}
+
+// Monitor checks the status of every buoy at regular intervals and records
+// an event each time it changes. It keeps the status of each buoy in
+// memory; after a restart a buoy's status is taken from its latest event.
+// The first time a buoy with no events is checked, its status is taken as
+// it is, without an event.
+type Monitor struct {
+	events   storage.StatusStore
+	interval time.Duration
+
+	mu     sync.Mutex
+	states map[primitive.ObjectID]*buoyState
+	// Each buoy is checked by one sweep or new reading at a time, and
+	// different buoys at the same time
+	buoyLocks map[primitive.ObjectID]*sync.Mutex
+}
+
+// NewMonitor returns a monitor expecting buoys without a report interval of
+// their own to report every defaultInterval
+func NewMonitor(events storage.StatusStore, defaultInterval time.Duration) *Monitor {
+	return &Monitor{
+		events:    events,
+		interval:  defaultInterval,
+		states:    make(map[primitive.ObjectID]*buoyState),
+		buoyLocks: make(map[primitive.ObjectID]*sync.Mutex),
+	}
+}
+
+// Interval returns the time expected between a buoy's reports
+func (m *Monitor) Interval(buoy models.Buoy) time.Duration {
+	if buoy.ReportInterval > 0 {
+		return time.Duration(buoy.ReportInterval) * time.Second
+	}
+	return m.interval
+}
+
+// Status returns whether a buoy is online, late or offline at a time. A buoy
+// that never reported is offline.
+func (m *Monitor) Status(buoy models.Buoy, now time.Time) string {
+	last := lastReport(buoy)
+	if last == nil {
+		return models.StatusOffline
+	}
+
+	age := now.Sub(last.Time)
+	interval := float64(m.Interval(buoy))
+	switch {
+	case age <= time.Duration(lateAfter*interval):
+		return models.StatusOnline
+	case age <= time.Duration(offlineAfter*interval):
+		return models.StatusLate
+	default:
+		return models.StatusOffline
+	}
+}
+
+// Run checks the status of every buoy until ctx is done
+func (m *Monitor) Run(ctx context.Context, buoys storage.BuoyStore) {
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+	for {
+		m.checkAll(ctx, buoys)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) checkAll(ctx context.Context, buoys storage.BuoyStore) {
+	ctx, cancel := context.WithTimeout(ctx, checkEvery)
+	defer cancel()
+
+	all, err := buoys.ListBuoys(ctx)
+	if err != nil {
+		log.Println("presence: failed to list buoys:", err)
+		return
+	}
+	now := time.Now()
+
+	listed := make(map[primitive.ObjectID]bool, len(all))
+	for _, buoy := range all {
+		listed[buoy.ID] = true
+		lock := m.buoyLock(buoy.ID)
+		lock.Lock()
+		err := m.check(ctx, buoy, now)
+		lock.Unlock()
+		if err != nil {
+			log.Println("presence: failed to check status of buoy", buoy.ID.Hex(), ":", err)
+		}
+	}
+	// Deleted buoys
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.states {
+		if !listed[id] {
+			delete(m.states, id)
+			delete(m.buoyLocks, id)
+		}
+	}
+}
+
+// The lock of a buoy's checks
+func (m *Monitor) buoyLock(buoyID primitive.ObjectID) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.buoyLocks[buoyID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.buoyLocks[buoyID] = lock
+	}
+	return lock
+}
+
+// The state of a buoy, taken from its latest event the first time. A buoy
+// with no events starts at status. Must be called with the buoy locked; the
+// monitor is only locked to look the state up and keep it.
+func (m *Monitor) state(ctx context.Context, buoyID primitive.ObjectID, status string) (*buoyState, error) {
+	m.mu.Lock()
+	st, ok := m.states[buoyID]
+	m.mu.Unlock()
+	if ok {
+		return st, nil
+	}
+
+	st = &buoyState{status: status}
+	latest, err := m.events.LatestStatusEvent(ctx, buoyID)
+	switch {
+	case err == nil:
+		st.status = latest.Status
+		st.exercise = latest.Exercise
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+	m.mu.Lock()
+	m.states[buoyID] = st
+	m.mu.Unlock()
+	return st, nil
+}
+
+// Record an event if a buoy's status changed. Must be called with the buoy
+// locked.
+func (m *Monitor) check(ctx context.Context, buoy models.Buoy, now time.Time) error {
+	status := m.Status(buoy, now)
+	last := lastReport(buoy)
+
+	st, err := m.state(ctx, buoy.ID, status)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		if last.Before(st.last) {
+			return nil
+		}
+		st.last = last.Time
+	}
+	if status == st.status {
+		return nil
+	}
+
+	_, err = m.events.AddStatusEvent(ctx, models.StatusEvent{
+		BuoyID:     buoy.ID,
+		Status:     status,
+		Previous:   st.status,
+		LastReport: last,
+		Timestamp:  models.NewTimestamp(now),
+		Exercise:   st.exercise,
+	})
+	// The status is left as it was, so the change is recorded at the next
+	// check
+	if err != nil {
+		return err
+	}
+	st.status = status
+	return nil
+}
+
+// Store wraps a BuoyStore so that the buoys it returns have their status
+// set, and a buoy storing new readings has its status checked at once
+// rather than at the next check
+func (m *Monitor) Store(buoys storage.BuoyStore) storage.BuoyStore {
+	return &monitoredStore{BuoyStore: buoys, monitor: m}
+}
+
+type monitoredStore struct {
+	storage.BuoyStore
+	monitor *Monitor
+}
+
+func (s *monitoredStore) withStatus(buoy models.Buoy) models.Buoy {
+	buoy.Status = s.monitor.Status(buoy, time.Now())
+	return buoy
+}
+
+func (s *monitoredStore) GetBuoy(ctx context.Context, id primitive.ObjectID) (models.Buoy, error) {
+	buoy, err := s.BuoyStore.GetBuoy(ctx, id)
+	if err != nil {
+		return buoy, err
+	}
+	return s.withStatus(buoy), nil
+}
+
+func (s *monitoredStore) UpdateBuoy(ctx context.Context, id primitive.ObjectID, buoy models.Buoy) (models.Buoy, error) {
+	updated, err := s.BuoyStore.UpdateBuoy(ctx, id, buoy)
+	if err != nil {
+		return updated, err
+	}
+	return s.withStatus(updated), nil
+}
+
+func (s *monitoredStore) ListBuoys(ctx context.Context) ([]models.Buoy, error) {
+	buoys, err := s.BuoyStore.ListBuoys(ctx)
+	for i := range buoys {
+		buoys[i] = s.withStatus(buoys[i])
+	}
+	return buoys, err
+}
+
+func (s *monitoredStore) BuoysNear(ctx context.Context, lat, lon, radiusKm float64) ([]storage.NearbyBuoy, error) {
+	buoys, err := s.BuoyStore.BuoysNear(ctx, lat, lon, radiusKm)
+	for i := range buoys {
+		buoys[i].Buoy = s.withStatus(buoys[i].Buoy)
+	}
+	return buoys, err
+}
+
+func (s *monitoredStore) BuoysWithin(ctx context.Context, bbox storage.BBox) ([]models.Buoy, error) {
+	buoys, err := s.BuoyStore.BuoysWithin(ctx, bbox)
+	for i := range buoys {
+		buoys[i] = s.withStatus(buoys[i])
+	}
+	return buoys, err
+}
+
+// A reading passed to the store, whose time may become the buoy's last
+// report time
+type report struct {
+	timestamp time.Time
+	synthetic bool
+}
+
+// Check a buoy's status if any of its readings were stored. A status change
+// is an exercise if the reading the buoy's last report time is taken from
+// is synthetic; a late backfill leaves that as it was.
+func (s *monitoredStore) reported(ctx context.Context, id primitive.ObjectID, duplicate []bool, reports []report) {
+	stored := false
+	for _, d := range duplicate {
+		stored = stored || !d
+	}
+	if !stored {
+		return
+	}
+
+	buoy, err := s.BuoyStore.GetBuoy(ctx, id)
+	if err == nil {
+		now := time.Now()
+		lock := s.monitor.buoyLock(id)
+		lock.Lock()
+		var st *buoyState
+		if st, err = s.monitor.state(ctx, id, s.monitor.Status(buoy, now)); err == nil {
+			// Stores keep times to the millisecond
+			if last := lastReport(buoy); last != nil {
+				for i, r := range reports {
+					if !duplicate[i] && r.timestamp.Truncate(time.Millisecond).Equal(last.Time.Truncate(time.Millisecond)) {
+						st.exercise = r.synthetic
+					}
+				}
+			}
+			err = s.monitor.check(ctx, buoy, now)
+		}
+		lock.Unlock()
+	}
+	if err != nil {
+		log.Println("presence: failed to check status of buoy", id.Hex(), ":", err)
+	}
+}
+
+func (s *monitoredStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddWaves(ctx, id, waves...)
+	if err == nil {
+		reports := make([]report, len(waves))
+		for i, w := range waves {
+			reports[i] = report{timestamp: w.Timestamp.Time, synthetic: w.Synthetic}
+		}
+		s.reported(ctx, id, duplicate, reports)
+	}
+	return duplicate, err
+}
+
+func (s *monitoredStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddTelemetry(ctx, id, records...)
+	if err == nil {
+		reports := make([]report, len(records))
+		for i, r := range records {
+			reports[i] = report{timestamp: r.Timestamp.Time}
+		}
+		s.reported(ctx, id, duplicate, reports)
+	}
+	return duplicate, err
+}
+
+func (s *monitoredStore) AddSpectra(ctx context.Context, id primitive.ObjectID, spectra ...models.WaveSpectrum) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddSpectra(ctx, id, spectra...)
+	if err == nil {
+		reports := make([]report, len(spectra))
+		for i, sp := range spectra {
+			reports[i] = report{timestamp: sp.Timestamp.Time}
+		}
+		s.reported(ctx, id, duplicate, reports)
+	}
+	return duplicate, err
+}
+
+func (s *monitoredStore) AddObservations(ctx context.Context, id primitive.ObjectID, payload string, observations ...models.Observation) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddObservations(ctx, id, payload, observations...)
+	if err == nil {
+		reports := make([]report, len(observations))
+		for i, o := range observations {
+			reports[i] = report{timestamp: o.Timestamp.Time, synthetic: o.Synthetic}
+		}
+		s.reported(ctx, id, duplicate, reports)
+	}
+	return duplicate, err
+}
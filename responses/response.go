@@ -0,0 +1,9 @@
+package responses
+
+// Response is the envelope of responses about resources other than buoys
+// and users, such as webhooks and alerts
+type Response struct {
+	Status  int                    `json:"status"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data"`
+}
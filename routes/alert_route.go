@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/alerting"
+	"od-api/controllers"
+	"od-api/storage"
+)
+
+func AlertRoute(router *gin.Engine, alerts storage.AlertStore, engine *alerting.Engine) {
+	router.POST("/alerts/rules", controllers.CreateAlertRule(alerts, engine))
+	router.GET("/alerts/rules", controllers.GetAlertRules(alerts))
+	router.GET("/alerts/rules/:ruleId", controllers.GetAlertRule(alerts))
+	router.PUT("/alerts/rules/:ruleId", controllers.EditAlertRule(alerts, engine))
+	router.DELETE("/alerts/rules/:ruleId", controllers.DeleteAlertRule(alerts, engine))
+	router.GET("/alerts", controllers.GetAlerts(alerts))
+}
@@ -1,15 +1,39 @@
 package routes
 
 import (
+	"time"
+
 	"od-api/controllers"
+	"od-api/idempotency"
+	"od-api/storage"
     "github.com/gin-gonic/gin"
 )
 
-func BuoyRoute(router *gin.Engine) {
-	router.POST("/buoy", controllers.CreateBuoy())
-	router.GET("/buoy/:buoyId", controllers.GetABuoy())
-	router.PUT("/buoy/:buoyId", controllers.EditBuoy())
-	router.DELETE("/buoy/:buoyId", controllers.DeleteBuoy())
-	router.GET("/buoys", controllers.GetAllBuoys())
-	router.POST("/buoy/:buoyId/waves", controllers.AddWavesDataToBuoy()) // New endpoint to add waves data
+func BuoyRoute(router *gin.Engine, buoys storage.BuoyStore) {
+	// Ingestion endpoints can be retried with an Idempotency-Key header
+	idempotent := idempotency.New(24*time.Hour, controllers.MaxBatchBytes).Middleware()
+
+	router.POST("/buoy", controllers.CreateBuoy(buoys))
+	router.GET("/buoy/:buoyId", controllers.GetABuoy(buoys))
+	router.PUT("/buoy/:buoyId", controllers.EditBuoy(buoys))
+	router.DELETE("/buoy/:buoyId", controllers.DeleteBuoy(buoys))
+	router.GET("/buoys", controllers.GetAllBuoys(buoys))
+	router.GET("/buoys/near", controllers.GetBuoysNear(buoys))
+	router.GET("/buoys/within", controllers.GetBuoysWithin(buoys))
+	router.POST("/buoys/waves:batch", idempotent, controllers.AddFleetWavesBatch(buoys))
+	router.POST("/buoy/:buoyId/waves", idempotent, controllers.AddWavesDataToBuoy(buoys)) // New endpoint to add waves data
+	router.POST("/buoy/:buoyId/waves:batch", idempotent, controllers.AddWavesBatchToBuoy(buoys))
+	router.POST("/buoy/:buoyId/waves/ndbc", idempotent, controllers.AddNDBCWavesToBuoy(buoys))
+	router.POST("/buoy/:buoyId/spotter", idempotent, controllers.AddSpotterDataToBuoy(buoys))
+	router.GET("/buoy/:buoyId/track", controllers.GetBuoyTrack(buoys))
+	router.GET("/buoy/:buoyId/waves", controllers.GetBuoyWaves(buoys))
+	router.GET("/buoy/:buoyId/waves/aggregate", controllers.GetBuoyWavesAggregate(buoys))
+	router.GET("/buoy/:buoyId/waves/export", controllers.GetBuoyWavesExport(buoys))
+	router.POST("/buoy/:buoyId/telemetry", idempotent, controllers.AddTelemetryToBuoy(buoys))
+	router.GET("/buoy/:buoyId/telemetry", controllers.GetBuoyTelemetry(buoys))
+	router.POST("/buoy/:buoyId/spectra", idempotent, controllers.AddSpectrumToBuoy(buoys))
+	router.GET("/buoy/:buoyId/spectra", controllers.GetBuoySpectra(buoys))
+	router.GET("/payloads", controllers.GetPayloadTypes())
+	router.POST("/buoy/:buoyId/observations/:payload", idempotent, controllers.AddObservationToBuoy(buoys))
+	router.GET("/buoy/:buoyId/observations/:payload", controllers.GetBuoyObservations(buoys))
 }
\ No newline at end of file
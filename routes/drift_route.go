@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/storage"
+)
+
+func DriftRoute(router *gin.Engine, drifts storage.DriftStore) {
+	router.GET("/buoys/drift-events", controllers.GetDriftEvents(drifts))
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/simulator"
+	"od-api/storage"
+)
+
+func SimulatorRoute(router *gin.Engine, buoys storage.BuoyStore, simulations *simulator.Manager) {
+	router.GET("/admin/simulator", controllers.GetSimulatedBuoys(simulations))
+	router.POST("/admin/simulator", controllers.StartSimulatedBuoy(buoys, simulations))
+	router.POST("/admin/simulator/scenarios", controllers.PlayScenario(buoys, simulations))
+	router.GET("/admin/simulator/:buoyId", controllers.GetSimulatedBuoy(simulations))
+	router.PUT("/admin/simulator/:buoyId", controllers.EditSimulatedBuoy(buoys, simulations))
+	router.DELETE("/admin/simulator/:buoyId", controllers.StopSimulatedBuoy(simulations))
+}
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/storage"
+)
+
+func StatusRoute(router *gin.Engine, statuses storage.StatusStore) {
+	router.GET("/buoys/status-events", controllers.GetStatusEvents(statuses))
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/storage"
+	"od-api/stream"
+)
+
+func StreamRoute(router *gin.Engine, buoys storage.BuoyStore, hub *stream.Hub) {
+	router.GET("/buoy/:buoyId/stream", controllers.GetBuoyStream(buoys, hub))
+	router.GET("/buoys/stream", controllers.GetBuoysStream(hub))
+}
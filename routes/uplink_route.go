@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/uplink"
+)
+
+func UplinkRoute(router *gin.Engine, subscriber *uplink.Subscriber) {
+	router.GET("/uplinks/mqtt", controllers.GetMQTTStatus(subscriber))
+}
@@ -2,13 +2,14 @@ package routes
 
 import (
     "od-api/controllers"
+    "od-api/storage"
     "github.com/gin-gonic/gin"
 )
 
-func UserRoute(router *gin.Engine) {
-    router.POST("/user", controllers.CreateUser())
-    router.GET("/user/:userId", controllers.GetAUser())
-    router.PUT("/user/:userId", controllers.EditAUser())
-    router.DELETE("/user/:userId", controllers.DeleteAUser())
-    router.GET("/users", controllers.GetAllUsers())
+func UserRoute(router *gin.Engine, users storage.UserStore) {
+    router.POST("/user", controllers.CreateUser(users))
+    router.GET("/user/:userId", controllers.GetAUser(users))
+    router.PUT("/user/:userId", controllers.EditAUser(users))
+    router.DELETE("/user/:userId", controllers.DeleteAUser(users))
+    router.GET("/users", controllers.GetAllUsers(users))
 }
\ No newline at end of file
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"od-api/controllers"
+	"od-api/storage"
+	"od-api/webhook"
+)
+
+func WebhookRoute(router *gin.Engine, webhooks storage.WebhookStore, dispatcher *webhook.Dispatcher) {
+	router.POST("/webhooks", controllers.CreateWebhook(webhooks, dispatcher))
+	router.GET("/webhooks", controllers.GetWebhooks(webhooks))
+	router.GET("/webhooks/:webhookId", controllers.GetWebhook(webhooks))
+	router.PUT("/webhooks/:webhookId", controllers.EditWebhook(webhooks, dispatcher))
+	router.DELETE("/webhooks/:webhookId", controllers.DeleteWebhook(webhooks, dispatcher))
+	router.GET("/webhooks/:webhookId/dead-letters", controllers.GetDeadLetters(webhooks))
+	router.POST("/webhooks/:webhookId/dead-letters/:deadLetterId/retry", controllers.RetryDeadLetter(webhooks, dispatcher))
+	router.DELETE("/webhooks/:webhookId/dead-letters/:deadLetterId", controllers.DeleteDeadLetter(webhooks))
+}
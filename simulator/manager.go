@@ -0,0 +1,311 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"od-api/models"
+)
+
+var (
+	ErrSimulated    = errors.New("simulator: buoy is already simulated")
+	ErrNotSimulated = errors.New("simulator: buoy is not simulated")
+	ErrSeedChange   = errors.New("simulator: the seed of a simulated buoy cannot be changed, stop and start it again")
+	ErrShutdown     = errors.New("simulator: shutting down")
+)
+
+// Status of a simulated buoy
+type Status struct {
+	Config    Config           `json:"config"`
+	StartedAt models.Timestamp `json:"startedAt"`
+	// Readings stored, or already stored, and readings the sink failed to
+	// store
+	Readings    int               `json:"readings"`
+	Failed      int               `json:"failed"`
+	LastReading *models.Timestamp `json:"lastReading,omitempty"`
+	NextReading models.Timestamp  `json:"nextReading"`
+	LastError   string            `json:"lastError,omitempty"`
+	// Scenario being played, when it ends and whether the buoy was lost
+	Scenario    string            `json:"scenario,omitempty"`
+	ScenarioEnd *models.Timestamp `json:"scenarioEnd,omitempty"`
+	Lost        bool              `json:"lost,omitempty"`
+}
+
+// A running simulation
+type simulation struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// Wakes the simulation up when its generator is reconfigured
+	reset chan struct{}
+
+	mu        sync.Mutex
+	generator *Generator
+	// Scenario being played, if any
+	drill  *drill
+	status Status
+}
+
+func (s *simulation) snapshot() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Config = s.generator.config
+	status.NextReading = models.NewTimestamp(s.generator.next)
+	if s.drill != nil {
+		end := models.NewTimestamp(s.drill.end())
+		status.Scenario, status.ScenarioEnd, status.Lost = s.drill.scenario.Name, &end, s.drill.lost
+	}
+	return status
+}
+
+// The readings of the next step, and whether the simulation is over. Must be
+// called with the simulation locked.
+func (s *simulation) step() (drillReadings, bool) {
+	if s.drill != nil {
+		return s.drill.step(s.generator)
+	}
+	waves := s.generator.Next()
+	return drillReadings{waves: &waves}, false
+}
+
+// Manager runs the simulated buoys, each in its own goroutine, and starts,
+// stops and reconfigures them while the server runs. Every simulation stops
+// when the context the manager was made with is done.
+type Manager struct {
+	ctx  context.Context
+	sink Sink
+
+	mu          sync.Mutex
+	simulations map[string]*simulation
+	wg          sync.WaitGroup
+}
+
+// NewManager returns a manager handing the readings of the buoys it
+// simulates to sink
+func NewManager(ctx context.Context, sink Sink) *Manager {
+	return &Manager{
+		ctx:         ctx,
+		sink:        sink,
+		simulations: make(map[string]*simulation),
+	}
+}
+
+// Start simulates a buoy from now on
+func (m *Manager) Start(config Config) (Status, error) {
+	return m.start(config, nil)
+}
+
+// Play simulates the buoy of a scenario from now on, for the scenario's
+// duration. Every reading is marked synthetic, like those of any simulated
+// buoy, so what the drill raises is marked as an exercise.
+func (m *Manager) Play(scenario Scenario) (Status, error) {
+	if err := scenario.check(); err != nil {
+		return Status{}, err
+	}
+	return m.start(scenario.Buoy, &scenario)
+}
+
+func (m *Manager) start(config Config, scenario *Scenario) (Status, error) {
+	now := time.Now()
+	generator, err := New(config, now)
+	if err != nil {
+		return Status{}, err
+	}
+	config = generator.config
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		return Status{}, ErrShutdown
+	}
+	if _, ok := m.simulations[config.BuoyID]; ok {
+		return Status{}, ErrSimulated
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	sim := &simulation{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		reset:     make(chan struct{}, 1),
+		generator: generator,
+		status:    Status{StartedAt: models.NewTimestamp(now)},
+	}
+	if scenario != nil {
+		sim.drill = newDrill(*scenario, generator.next)
+	}
+	m.simulations[config.BuoyID] = sim
+	m.wg.Add(1)
+	go m.run(ctx, sim)
+	if scenario != nil {
+		log.Println("simulator: playing scenario", scenario.Name, "on buoy", config.BuoyID, "with seed", config.Seed)
+	} else {
+		log.Println("simulator: started buoy", config.BuoyID, "with seed", config.Seed)
+	}
+	return sim.snapshot(), nil
+}
+
+// Stop stops simulating a buoy, and waits for a reading being stored to
+// finish
+func (m *Manager) Stop(buoyID string) error {
+	m.mu.Lock()
+	sim, ok := m.simulations[buoyID]
+	delete(m.simulations, buoyID)
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotSimulated
+	}
+
+	sim.cancel()
+	<-sim.done
+	log.Println("simulator: stopped buoy", buoyID)
+	return nil
+}
+
+// Reconfigure replaces the settings of a simulated buoy. Its sea state
+// carries on from where it is, so the seed cannot change; a config without
+// one keeps the buoy's.
+func (m *Manager) Reconfigure(buoyID string, config Config) (Status, error) {
+	m.mu.Lock()
+	sim, ok := m.simulations[buoyID]
+	m.mu.Unlock()
+	if !ok {
+		return Status{}, ErrNotSimulated
+	}
+
+	sim.mu.Lock()
+	seed := sim.generator.config.Seed
+	sim.mu.Unlock()
+	if config.Seed != 0 && config.Seed != seed {
+		return Status{}, ErrSeedChange
+	}
+	config.BuoyID, config.Seed = buoyID, seed
+	config, err := config.withDefaults()
+	if err != nil {
+		return Status{}, err
+	}
+
+	sim.mu.Lock()
+	sim.generator.reconfigure(config)
+	sim.mu.Unlock()
+	select {
+	case sim.reset <- struct{}{}:
+	default:
+	}
+	return sim.snapshot(), nil
+}
+
+// Get returns the status of a simulated buoy
+func (m *Manager) Get(buoyID string) (Status, error) {
+	m.mu.Lock()
+	sim, ok := m.simulations[buoyID]
+	m.mu.Unlock()
+	if !ok {
+		return Status{}, ErrNotSimulated
+	}
+	return sim.snapshot(), nil
+}
+
+// List returns the status of every simulated buoy, by buoy ID
+func (m *Manager) List() []Status {
+	m.mu.Lock()
+	statuses := make([]Status, 0, len(m.simulations))
+	for _, sim := range m.simulations {
+		statuses = append(statuses, sim.snapshot())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Config.BuoyID < statuses[j].Config.BuoyID })
+	return statuses
+}
+
+// Wait waits for every simulation to stop once the manager's context is
+// done
+func (m *Manager) Wait() {
+	<-m.ctx.Done()
+	m.wg.Wait()
+}
+
+// Hand a simulation's readings to the sink as their time comes, until ctx is
+// done
+func (m *Manager) run(ctx context.Context, sim *simulation) {
+	defer m.wg.Done()
+	defer close(sim.done)
+	defer sim.cancel()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sim.reset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			sim.mu.Lock()
+			timer.Reset(time.Until(sim.generator.next))
+			sim.mu.Unlock()
+			continue
+		case <-timer.C:
+		}
+
+		sim.mu.Lock()
+		readings, over := sim.step()
+		buoyID := sim.generator.config.BuoyID
+		sim.mu.Unlock()
+		if over {
+			m.finish(buoyID, sim)
+			return
+		}
+
+		// The sink is called unlocked, so the status can be read meanwhile
+		var errs []error
+		stored := 0
+		if w := readings.waves; w != nil {
+			if err := m.sink.AddWaves(buoyID, *w); err != nil {
+				errs = append(errs, err)
+			} else {
+				stored++
+			}
+		}
+		if o := readings.waterLevel; o != nil {
+			if err := m.sink.AddObservation(buoyID, WaterLevelPayload, *o); err != nil {
+				errs = append(errs, err)
+			} else {
+				stored++
+			}
+		}
+
+		sim.mu.Lock()
+		for _, err := range errs {
+			log.Println("simulator: failed to store reading of buoy", buoyID, ":", err)
+			sim.status.Failed++
+			sim.status.LastError = err.Error()
+		}
+		if stored > 0 {
+			sim.status.Readings += stored
+			timestamp := models.NewTimestamp(sim.generator.previous)
+			sim.status.LastReading = &timestamp
+		}
+		timer.Reset(time.Until(sim.generator.next))
+		sim.mu.Unlock()
+	}
+}
+
+// Stop simulating a buoy whose scenario is over, unless it was stopped
+// meanwhile
+func (m *Manager) finish(buoyID string, sim *simulation) {
+	m.mu.Lock()
+	if m.simulations[buoyID] == sim {
+		delete(m.simulations, buoyID)
+	}
+	m.mu.Unlock()
+	log.Println("simulator: finished scenario", sim.drill.scenario.Name, "on buoy", buoyID)
+}
@@ -0,0 +1,296 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"od-api/models"
+)
+
+// Event types of a scenario
+const (
+	EventStorm     = "storm"
+	EventTsunami   = "tsunami"
+	EventRogueWave = "rogue-wave"
+	EventLoss      = "loss"
+)
+
+// Payload the water level of a scenario is stored as
+const WaterLevelPayload = "waterlevel"
+
+const (
+	// Period of the principal lunar semi-diurnal tide, M2
+	tidePeriod = 12*time.Hour + 25*time.Minute + 14*time.Second
+	// Measurement noise of the water level in meters
+	waterLevelNoise = 0.01
+
+	defaultTsunamiPeriod = 15 * time.Minute
+	defaultTsunamiDecay  = 2 * time.Hour
+	// Height of a rogue wave over the significant wave height, when the
+	// event does not give one. Waves over twice the significant height are
+	// rogue.
+	defaultRogueFactor = 2.5
+)
+
+var (
+	ErrMissingScenarioName = errors.New("simulator: scenario name is required")
+	ErrScenarioDuration    = errors.New("simulator: scenario duration must be positive")
+)
+
+// Duration is a time.Duration written as a string such as "12h" or "90m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New(`durations must be strings such as "12h" or "90m"`)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Scenario is a scripted drill played on a simulated buoy. Its events change
+// the sea state and water level the buoy reports, from the time the scenario
+// starts until Duration later, when the buoy stops being simulated.
+type Scenario struct {
+	Name     string   `json:"name"`
+	Buoy     Config   `json:"buoy"`
+	Duration Duration `json:"duration"`
+	// Amplitude in meters of the semi-diurnal tide of the water level
+	Tide   float64 `json:"tide,omitempty"`
+	Events []Event `json:"events"`
+}
+
+// Event of a scenario, At after it starts. The meaning of the other fields
+// depends on the type:
+//   - storm: the mean wave height builds up to Height over Duration, holds
+//     for Hold, and dies down over Duration again. The water level rises by
+//     Surge meters at the peak.
+//   - tsunami: the water level oscillates with Period from At, starting
+//     with a crest of Amplitude meters, and decays by e every Duration.
+//   - rogue-wave: the next reading has a highest wave of Height meters.
+//   - loss: the buoy stops reporting for the rest of the scenario.
+type Event struct {
+	Type      string   `json:"type"`
+	At        Duration `json:"at"`
+	Duration  Duration `json:"duration,omitempty"`
+	Hold      Duration `json:"hold,omitempty"`
+	Height    float64  `json:"height,omitempty"`
+	Surge     float64  `json:"surge,omitempty"`
+	Amplitude float64  `json:"amplitude,omitempty"`
+	Period    Duration `json:"period,omitempty"`
+}
+
+// ParseScenario reads a scenario from YAML or JSON, which is YAML too
+func ParseScenario(data []byte) (Scenario, error) {
+	// YAML is turned into JSON so the JSON field names and types apply
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Scenario{}, err
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Scenario{}, err
+	}
+
+	var scenario Scenario
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scenario); err != nil {
+		return Scenario{}, fmt.Errorf("simulator: invalid scenario: %v", err)
+	}
+	return scenario, scenario.check()
+}
+
+// Check the scenario's events and fill in their defaults. The buoy config
+// is checked when the scenario is played.
+func (s *Scenario) check() error {
+	if s.Name == "" {
+		return ErrMissingScenarioName
+	}
+	if s.Duration <= 0 {
+		return ErrScenarioDuration
+	}
+	if s.Tide < 0 {
+		return errors.New("simulator: scenario tide must not be negative")
+	}
+
+	for i := range s.Events {
+		e := &s.Events[i]
+		invalid := func(reason string) error {
+			return fmt.Errorf("simulator: scenario event %d (%s) %s", i+1, e.Type, reason)
+		}
+		if e.At < 0 || e.At > s.Duration {
+			return invalid("must be at a time within the scenario duration")
+		}
+		if e.Duration < 0 || e.Hold < 0 || e.Period < 0 {
+			return invalid("durations must not be negative")
+		}
+
+		switch e.Type {
+		case EventStorm:
+			if e.Height <= 0 || e.Duration == 0 {
+				return invalid("needs a positive height and duration")
+			}
+			if e.Surge < 0 {
+				return invalid("surge must not be negative")
+			}
+		case EventTsunami:
+			if e.Amplitude <= 0 {
+				return invalid("needs a positive amplitude")
+			}
+			if e.Period == 0 {
+				e.Period = Duration(defaultTsunamiPeriod)
+			}
+			if e.Duration == 0 {
+				e.Duration = Duration(defaultTsunamiDecay)
+			}
+		case EventRogueWave:
+			if e.Height < 0 {
+				return invalid("height must not be negative")
+			}
+		case EventLoss:
+		default:
+			return fmt.Errorf("simulator: scenario event %d has unknown type %q, expected storm, tsunami, rogue-wave or loss", i+1, e.Type)
+		}
+	}
+	return nil
+}
+
+// WaterLevel reports whether the scenario's buoy reports a water level
+// besides waves readings, as WaterLevelPayload observations
+func (s *Scenario) WaterLevel() bool {
+	if s.Tide > 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e.Type == EventTsunami || (e.Type == EventStorm && e.Surge > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// How far into a storm the sea is at an offset from the scenario start,
+// from 0 before and after it to 1 at its peak. It builds up and dies down
+// along a sine squared, so it changes smoothly.
+func (e Event) stormLevel(offset time.Duration) float64 {
+	x := offset - time.Duration(e.At)
+	build, hold := time.Duration(e.Duration), time.Duration(e.Hold)
+	ramp := func(fraction float64) float64 {
+		return math.Pow(math.Sin(fraction*math.Pi/2), 2)
+	}
+	switch {
+	case x <= 0 || x >= 2*build+hold:
+		return 0
+	case x < build:
+		return ramp(float64(x) / float64(build))
+	case x <= build+hold:
+		return 1
+	default:
+		return ramp(1 - float64(x-build-hold)/float64(build))
+	}
+}
+
+// Water level of a tsunami at an offset from the scenario start
+func (e Event) tsunamiLevel(offset time.Duration) float64 {
+	x := offset - time.Duration(e.At)
+	if x < 0 {
+		return 0
+	}
+	decay := math.Exp(-float64(x) / float64(e.Duration))
+	return e.Amplitude * decay * math.Sin(2*math.Pi*float64(x)/float64(e.Period))
+}
+
+// A scenario being played on a generator
+type drill struct {
+	scenario Scenario
+	start    time.Time
+	// Rogue waves already played, by event index
+	played map[int]bool
+	lost   bool
+}
+
+func newDrill(scenario Scenario, start time.Time) *drill {
+	return &drill{scenario: scenario, start: start, played: make(map[int]bool)}
+}
+
+func (d *drill) end() time.Time {
+	return d.start.Add(time.Duration(d.scenario.Duration))
+}
+
+// Readings of a drill's buoy at one time. Waves is nil once the buoy is lost,
+// and WaterLevel when the scenario has none.
+type drillReadings struct {
+	waves      *models.WavesData
+	waterLevel *models.Observation
+}
+
+// Play the next reading of the generator, and report whether the scenario
+// is over
+func (d *drill) step(g *Generator) (drillReadings, bool) {
+	offset := g.next.Sub(d.start)
+	if offset > time.Duration(d.scenario.Duration) {
+		return drillReadings{}, true
+	}
+
+	scale, surge, tsunami := 1.0, 0.0, 0.0
+	for _, e := range d.scenario.Events {
+		if offset < time.Duration(e.At) {
+			continue
+		}
+		switch e.Type {
+		case EventStorm:
+			level := e.stormLevel(offset)
+			scale *= 1 + (e.Height/g.config.MeanHeight-1)*level
+			surge += e.Surge * level
+		case EventTsunami:
+			tsunami += e.tsunamiLevel(offset)
+		case EventLoss:
+			d.lost = true
+		}
+	}
+
+	g.heightScale = scale
+	waves := g.Next()
+	if d.lost {
+		return drillReadings{}, false
+	}
+
+	for i, e := range d.scenario.Events {
+		if e.Type != EventRogueWave || d.played[i] || offset < time.Duration(e.At) {
+			continue
+		}
+		height := e.Height
+		if height == 0 {
+			height = defaultRogueFactor * waves.SignificantWaveHeight
+		}
+		waves.MaxWaveHeight = models.Float64(round(height, 2))
+		d.played[i] = true
+	}
+
+	readings := drillReadings{waves: &waves}
+	if d.scenario.WaterLevel() {
+		tide := d.scenario.Tide * math.Cos(2*math.Pi*float64(offset)/float64(tidePeriod))
+		level := tide + surge + tsunami + waterLevelNoise*g.rng.NormFloat64()
+		readings.waterLevel = &models.Observation{
+			Timestamp: waves.Timestamp,
+			Values:    map[string]float64{"waterLevel": round(level, 3)},
+			Synthetic: true,
+		}
+	}
+	return readings, false
+}
@@ -0,0 +1,343 @@
+// Package simulator generates waves readings for buoys without hardware, for
+// demos and for exercising the rest of the pipeline. Readings follow a
+// slowly changing sea state rather than independent random draws: wave
+// height reverts to a mean over hours, periods match a JONSWAP sea of that
+// height, and the buoy wanders on its mooring around its anchor.
+package simulator
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/geo"
+	"od-api/models"
+)
+
+// Defaults of the optional settings of a Config
+const (
+	DefaultInterval   = 60  // seconds
+	DefaultRadius     = 100 // meters
+	DefaultMeanHeight = 1.5 // meters
+)
+
+// Profiles are named sea states, by the mean significant wave height in
+// meters of the middle of their band in the WMO sea state code
+var Profiles = map[string]float64{
+	"smooth":     0.3,
+	"slight":     0.9,
+	"moderate":   1.9,
+	"rough":      3.2,
+	"very-rough": 5,
+	"high":       7.5,
+}
+
+// Parameters of the sea state. Each varies as an Ornstein-Uhlenbeck process:
+// it relaxes towards its mean over a time scale, with a steady spread
+// around it.
+const (
+	// Spread of the natural log of the significant wave height, giving
+	// heights of about a third to three times the mean
+	heightSpread    = 0.35
+	heightTimescale = 6 * time.Hour
+	// Relative sampling error of a wave height measured over a record
+	heightNoise = 0.05
+	// Length of the record a reading is measured over, which the highest
+	// wave of the reading is the highest of
+	recordLength = 30 * time.Minute
+
+	// Peak period over the square root of the significant wave height. DNV
+	// gives 3.6 to 5 for a JONSWAP spectrum, steep wind seas at the low end.
+	periodFactorMin       = 3.6
+	periodFactorMax       = 5.0
+	periodFactorMean      = 4.3
+	periodFactorSpread    = 0.25
+	periodFactorTimescale = 3 * time.Hour
+
+	// Degrees the peak direction swings around the mean direction of a
+	// config, and the bulk mean direction around the peak
+	peakDirectionSpread    = 15
+	peakDirectionTimescale = 4 * time.Hour
+	meanDirectionSpread    = 8
+	meanDirectionTimescale = time.Hour
+
+	// Directional spread at the peak, and how much wider it is over the
+	// whole spectrum
+	peakSpreadMean      = 25
+	peakSpreadSpread    = 5
+	peakSpreadMin       = 10
+	peakSpreadMax       = 45
+	peakSpreadTimescale = 2 * time.Hour
+	excessSpreadMean    = 12
+	excessSpreadSpread  = 3
+	excessSpreadMin     = 2
+
+	// The position relaxes towards the anchor over this time scale, with a
+	// spread of a third of the radius on each axis
+	positionTimescale = 30 * time.Minute
+
+	earthRadius = geo.EarthRadiusKm * 1000
+)
+
+var (
+	ErrInvalidBuoyID    = errors.New("simulator: buoyId must be a valid ObjectID")
+	ErrMissingAnchor    = errors.New("simulator: anchor is required")
+	ErrInvalidAnchor    = errors.New("simulator: anchor must be a GeoJSON Point with a longitude and latitude in range")
+	ErrInvalidSettings  = errors.New("simulator: interval, radius and meanHeight must not be negative")
+	ErrInvalidDirection = errors.New("simulator: meanDirection must be between 0 and 360")
+	ErrUnknownProfile   = errors.New("simulator: profile must be smooth, slight, moderate, rough, very-rough or high")
+)
+
+// Config of a simulated buoy
+type Config struct {
+	BuoyID string `json:"buoyId"`
+	// Seed of the random sequence: the same seed and settings give the same
+	// readings. A random seed is picked if it is zero.
+	Seed int64 `json:"seed,omitempty"`
+	// Seconds between readings
+	Interval int              `json:"interval,omitempty"`
+	Anchor   *models.GeoPoint `json:"anchor,omitempty"`
+	// Meters the buoy may wander from its anchor. It should be within the
+	// buoy's watch radius, or the buoy is reported adrift.
+	Radius float64 `json:"radius,omitempty"`
+	// Named sea state giving the mean wave height, one of Profiles
+	Profile string `json:"profile,omitempty"`
+	// Mean significant wave height in meters, taken over the profile's
+	MeanHeight float64 `json:"meanHeight,omitempty"`
+	// Mean direction the waves come from, in degrees from true north
+	MeanDirection float64 `json:"meanDirection,omitempty"`
+}
+
+// Check a config and fill in the defaults of its optional settings
+func (c Config) withDefaults() (Config, error) {
+	if _, err := primitive.ObjectIDFromHex(c.BuoyID); err != nil {
+		return c, ErrInvalidBuoyID
+	}
+	if c.Anchor == nil {
+		return c, ErrMissingAnchor
+	}
+	if len(c.Anchor.Coordinates) != 2 || c.Anchor.Coordinates[0] < -180 || c.Anchor.Coordinates[0] > 180 ||
+		c.Anchor.Coordinates[1] < -90 || c.Anchor.Coordinates[1] > 90 {
+		return c, ErrInvalidAnchor
+	}
+	if c.Interval < 0 || c.Radius < 0 || c.MeanHeight < 0 {
+		return c, ErrInvalidSettings
+	}
+	if c.MeanDirection < 0 || c.MeanDirection >= 360 {
+		return c, ErrInvalidDirection
+	}
+	profileHeight, ok := Profiles[c.Profile]
+	if c.Profile != "" && !ok {
+		return c, ErrUnknownProfile
+	}
+
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Radius == 0 {
+		c.Radius = DefaultRadius
+	}
+	if c.MeanHeight == 0 {
+		c.MeanHeight = profileHeight
+	}
+	if c.MeanHeight == 0 {
+		c.MeanHeight = DefaultMeanHeight
+	}
+	return c, nil
+}
+
+// Generator produces the readings of a simulated buoy, one every interval
+// from its start time. It is not safe for concurrent use.
+type Generator struct {
+	config Config
+	rng    *rand.Rand
+	// Times of the previous reading, zero before the first, and of the next
+	previous time.Time
+	next     time.Time
+
+	// Sea state
+	logHeight     float64
+	periodFactor  float64
+	peakDeviation float64
+	meanDeviation float64
+	peakSpread    float64
+	excessSpread  float64
+	// Offset from the anchor in meters
+	north, east float64
+	// Factor of the wave height, raised by a storm
+	heightScale float64
+}
+
+// New returns a generator whose first reading is at start. The state it
+// starts from is drawn from the seed, so it does not depend on start.
+func New(config Config, start time.Time) (*Generator, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		next:   start.Truncate(time.Second),
+
+		heightScale: 1,
+	}
+	offset := config.Radius / 3
+	g.logHeight = g.logMeanHeight() + heightSpread*g.rng.NormFloat64()
+	g.periodFactor = periodFactorMean + periodFactorSpread*g.rng.NormFloat64()
+	g.peakDeviation = peakDirectionSpread * g.rng.NormFloat64()
+	g.meanDeviation = meanDirectionSpread * g.rng.NormFloat64()
+	g.peakSpread = peakSpreadMean + peakSpreadSpread*g.rng.NormFloat64()
+	g.excessSpread = excessSpreadMean + excessSpreadSpread*g.rng.NormFloat64()
+	g.north = offset * g.rng.NormFloat64()
+	g.east = offset * g.rng.NormFloat64()
+	return g, nil
+}
+
+// Config returns the generator's config, with its defaults and seed filled
+// in
+func (g *Generator) Config() Config {
+	return g.config
+}
+
+// Replace the settings of the generator with those of a checked config. The
+// sea state carries on from where it is and relaxes to the new means, and
+// the next reading is one new interval after the previous one.
+func (g *Generator) reconfigure(config Config) {
+	g.config = config
+	if !g.previous.IsZero() {
+		g.next = g.previous.Add(g.Interval())
+	}
+}
+
+// Interval returns the time between readings
+func (g *Generator) Interval() time.Duration {
+	return time.Duration(g.config.Interval) * time.Second
+}
+
+// Mean of the log of the wave height, such that the height itself averages
+// the config's mean height
+func (g *Generator) logMeanHeight() float64 {
+	return math.Log(g.config.MeanHeight) - heightSpread*heightSpread/2
+}
+
+// Step an Ornstein-Uhlenbeck process from x towards mean over dt. The update
+// is exact for any dt, so the series has the same statistics whatever the
+// interval.
+func (g *Generator) step(x, mean, spread float64, timescale, dt time.Duration) float64 {
+	decay := math.Exp(-dt.Seconds() / timescale.Seconds())
+	return mean + (x-mean)*decay + spread*math.Sqrt(1-decay*decay)*g.rng.NormFloat64()
+}
+
+// Next returns the next reading, one interval after the previous one. It is
+// marked synthetic.
+func (g *Generator) Next() models.WavesData {
+	timestamp := g.next
+	g.previous = timestamp
+	g.next = g.next.Add(g.Interval())
+
+	height := g.heightScale * math.Exp(g.logHeight) * (1 + heightNoise*g.rng.NormFloat64())
+	factor := clamp(g.periodFactor, periodFactorMin, periodFactorMax)
+	peakPeriod := factor * math.Sqrt(height)
+	meanPeriod := meanPeriod(peakPeriod, jonswapGamma(factor))
+	peakDirection := g.config.MeanDirection + g.peakDeviation
+	peakSpread := clamp(g.peakSpread, peakSpreadMin, peakSpreadMax)
+	latitude, longitude := g.position()
+
+	w := models.WavesData{
+		SignificantWaveHeight: round(height, 2),
+		PeakPeriod:            models.Float64(round(peakPeriod, 2)),
+		MeanPeriod:            models.Float64(round(meanPeriod, 2)),
+		PeakDirection:         models.Float64(direction(peakDirection)),
+		PeakDirectionalSpread: models.Float64(round(peakSpread, 1)),
+		MeanDirection:         models.Float64(direction(peakDirection + g.meanDeviation)),
+		MeanDirectionalSpread: models.Float64(round(peakSpread+math.Max(g.excessSpread, excessSpreadMin), 1)),
+		MaxWaveHeight:         models.Float64(round(g.maxHeight(height, meanPeriod), 2)),
+		Timestamp:             models.NewTimestamp(timestamp),
+		Latitude:              round(latitude, 6),
+		Longitude:             round(longitude, 6),
+		Synthetic:             true,
+	}
+
+	dt := g.Interval()
+	g.logHeight = g.step(g.logHeight, g.logMeanHeight(), heightSpread, heightTimescale, dt)
+	g.periodFactor = g.step(g.periodFactor, periodFactorMean, periodFactorSpread, periodFactorTimescale, dt)
+	g.peakDeviation = g.step(g.peakDeviation, 0, peakDirectionSpread, peakDirectionTimescale, dt)
+	g.meanDeviation = g.step(g.meanDeviation, 0, meanDirectionSpread, meanDirectionTimescale, dt)
+	g.peakSpread = g.step(g.peakSpread, peakSpreadMean, peakSpreadSpread, peakSpreadTimescale, dt)
+	g.excessSpread = g.step(g.excessSpread, excessSpreadMean, excessSpreadSpread, meanDirectionTimescale, dt)
+	offset := g.config.Radius / 3
+	g.north = g.step(g.north, 0, offset, positionTimescale, dt)
+	g.east = g.step(g.east, 0, offset, positionTimescale, dt)
+	return w
+}
+
+// Draw the highest of the waves of a record of a sea state. Wave heights
+// follow a Rayleigh distribution in deep water, so the highest of n waves
+// is below h with probability (1 - exp(-2h²/Hs²))^n.
+func (g *Generator) maxHeight(height, meanPeriod float64) float64 {
+	n := recordLength.Seconds() / meanPeriod
+	// One minus the uniform draw to the power 1/n, without rounding it to 0
+	q := -math.Expm1(math.Log(g.rng.Float64()) / n)
+	return height * math.Sqrt(-math.Log(q)/2)
+}
+
+// The buoy's position, its offset from the anchor held within the radius
+func (g *Generator) position() (float64, float64) {
+	north, east := g.north, g.east
+	if distance := math.Hypot(north, east); distance > g.config.Radius {
+		north, east = north*g.config.Radius/distance, east*g.config.Radius/distance
+	}
+	anchorLat, anchorLon := g.config.Anchor.Coordinates[1], g.config.Anchor.Coordinates[0]
+	latitude := anchorLat + north/earthRadius*180/math.Pi
+	longitude := anchorLon + east/(earthRadius*math.Cos(anchorLat*math.Pi/180))*180/math.Pi
+	return latitude, longitude
+}
+
+// Sink stores the readings of simulated buoys
+type Sink interface {
+	AddWaves(buoyID string, waves models.WavesData) error
+	AddObservation(buoyID, payload string, observation models.Observation) error
+}
+
+// JONSWAP peak enhancement factor of a sea state from its peak period over
+// the square root of its significant wave height, as given by DNV
+func jonswapGamma(factor float64) float64 {
+	switch {
+	case factor <= periodFactorMin:
+		return 5
+	case factor >= periodFactorMax:
+		return 1
+	default:
+		return math.Exp(5.75 - 1.15*factor)
+	}
+}
+
+// Mean period, from the first moment of a JONSWAP spectrum, of a peak period
+func meanPeriod(peakPeriod, gamma float64) float64 {
+	return peakPeriod * (0.7303 + 0.04936*gamma - 0.006556*gamma*gamma + 0.0003610*gamma*gamma*gamma)
+}
+
+func clamp(x, min, max float64) float64 {
+	return math.Max(min, math.Min(max, x))
+}
+
+// A direction in [0, 360), to a tenth of a degree
+func direction(degrees float64) float64 {
+	d := round(math.Mod(math.Mod(degrees, 360)+360, 360), 1)
+	if d >= 360 {
+		d = 0
+	}
+	return d
+}
+
+func round(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
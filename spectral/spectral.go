@@ -0,0 +1,189 @@
+// Package spectral checks directional wave spectra and derives the bulk wave
+// parameters of WavesData from them.
+package spectral
+
+import (
+	"errors"
+	"math"
+
+	"od-api/models"
+)
+
+var (
+	ErrTooFewBins       = errors.New("spectrum needs at least 2 frequency bins")
+	ErrBinCount         = errors.New("spectrum arrays must have one value per frequency bin")
+	ErrFrequencyOrder   = errors.New("spectrum frequencies must be positive and increasing")
+	ErrBandwidth        = errors.New("spectrum bandwidths must be positive")
+	ErrNegativeEnergy   = errors.New("spectrum energy density cannot be negative")
+	ErrNoEnergy         = errors.New("spectrum has no energy")
+	ErrCoefficientRange = errors.New("spectrum directional coefficients must be between -1 and 1")
+	ErrDirectionRange   = errors.New("spectrum directions must be between 0 and 360")
+	ErrSpreadRange      = errors.New("spectrum directional spreads must be between 0 and 180")
+	ErrMissingTimestamp = errors.New("spectrum timestamp is required")
+	ErrFutureTimestamp  = errors.New("spectrum timestamp is in the future")
+	ErrInvalidPosition  = errors.New("spectrum latitude or longitude out of range")
+)
+
+// Validate checks the shape and ranges of a posted spectrum
+func Validate(s models.WaveSpectrum) error {
+	if s.Timestamp.IsZero() {
+		return ErrMissingTimestamp
+	}
+	if s.Timestamp.InFuture() {
+		return ErrFutureTimestamp
+	}
+	if s.Latitude < -90 || s.Latitude > 90 || s.Longitude < -180 || s.Longitude > 180 {
+		return ErrInvalidPosition
+	}
+
+	n := len(s.Frequency)
+	if n < 2 {
+		return ErrTooFewBins
+	}
+	if len(s.EnergyDensity) != n || len(s.A1) != n || len(s.B1) != n {
+		return ErrBinCount
+	}
+	for _, optional := range [][]float64{s.Bandwidth, s.A2, s.B2, s.Direction, s.DirectionalSpread} {
+		if optional != nil && len(optional) != n {
+			return ErrBinCount
+		}
+	}
+
+	for i, f := range s.Frequency {
+		if f <= 0 || (i > 0 && f <= s.Frequency[i-1]) {
+			return ErrFrequencyOrder
+		}
+	}
+	for _, df := range s.Bandwidth {
+		if df <= 0 {
+			return ErrBandwidth
+		}
+	}
+
+	energy := 0.0
+	for _, e := range s.EnergyDensity {
+		if e < 0 {
+			return ErrNegativeEnergy
+		}
+		energy += e
+	}
+	if energy == 0 {
+		return ErrNoEnergy
+	}
+
+	for _, coefficients := range [][]float64{s.A1, s.B1, s.A2, s.B2} {
+		for _, c := range coefficients {
+			if c < -1 || c > 1 {
+				return ErrCoefficientRange
+			}
+		}
+	}
+	for _, d := range s.Direction {
+		if d < 0 || d > 360 {
+			return ErrDirectionRange
+		}
+	}
+	for _, spread := range s.DirectionalSpread {
+		if spread < 0 || spread > 180 {
+			return ErrSpreadRange
+		}
+	}
+	return nil
+}
+
+// Bandwidths returns the width of each frequency bin, halfway to its
+// neighbours, for spectra that do not report it
+func Bandwidths(frequency []float64) []float64 {
+	n := len(frequency)
+	df := make([]float64, n)
+	for i := range frequency {
+		switch i {
+		case 0:
+			df[i] = frequency[1] - frequency[0]
+		case n - 1:
+			df[i] = frequency[n-1] - frequency[n-2]
+		default:
+			df[i] = (frequency[i+1] - frequency[i-1]) / 2
+		}
+	}
+	return df
+}
+
+// Direction waves come from, in nautical degrees, and directional spread in
+// degrees, of first order coefficients in the mathematical convention
+func directionAndSpread(a1, b1 float64) (float64, float64) {
+	direction := math.Mod(270-math.Atan2(b1, a1)*180/math.Pi, 360)
+	if direction < 0 {
+		direction += 360
+	}
+	r1 := math.Min(1, math.Hypot(a1, b1))
+	spread := math.Sqrt(2*(1-r1)) * 180 / math.Pi
+	return direction, spread
+}
+
+// Complete fills in the bandwidths and per-bin directions and spreads a
+// spectrum left out
+func Complete(s *models.WaveSpectrum) {
+	if s.Bandwidth == nil {
+		s.Bandwidth = Bandwidths(s.Frequency)
+	}
+	if s.Direction == nil || s.DirectionalSpread == nil {
+		direction := make([]float64, len(s.Frequency))
+		spread := make([]float64, len(s.Frequency))
+		for i := range s.Frequency {
+			direction[i], spread[i] = directionAndSpread(s.A1[i], s.B1[i])
+		}
+		if s.Direction == nil {
+			s.Direction = direction
+		}
+		if s.DirectionalSpread == nil {
+			s.DirectionalSpread = spread
+		}
+	}
+}
+
+// Bulk derives the bulk parameters of a valid spectrum: significant wave
+// height 4*sqrt(m0), peak period and direction at the most energetic bin,
+// mean period m0/m1, and mean direction and spread from the energy weighted
+// a1 and b1.
+func Bulk(s models.WaveSpectrum) models.WavesData {
+	df := s.Bandwidth
+	if df == nil {
+		df = Bandwidths(s.Frequency)
+	}
+
+	var m0, m1, a1, b1 float64
+	peak := 0
+	for i, f := range s.Frequency {
+		e := s.EnergyDensity[i] * df[i]
+		m0 += e
+		m1 += f * e
+		a1 += s.A1[i] * e
+		b1 += s.B1[i] * e
+		if s.EnergyDensity[i] > s.EnergyDensity[peak] {
+			peak = i
+		}
+	}
+
+	meanDirection, meanSpread := directionAndSpread(a1/m0, b1/m0)
+	// Per-bin values reported by the buoy take precedence
+	peakDirection, peakSpread := directionAndSpread(s.A1[peak], s.B1[peak])
+	if s.Direction != nil {
+		peakDirection = s.Direction[peak]
+	}
+	if s.DirectionalSpread != nil {
+		peakSpread = s.DirectionalSpread[peak]
+	}
+	return models.WavesData{
+		SignificantWaveHeight: 4 * math.Sqrt(m0),
+		PeakPeriod:            models.Float64(1 / s.Frequency[peak]),
+		MeanPeriod:            models.Float64(m0 / m1),
+		PeakDirection:         models.Float64(peakDirection),
+		PeakDirectionalSpread: models.Float64(peakSpread),
+		MeanDirection:         models.Float64(meanDirection),
+		MeanDirectionalSpread: models.Float64(meanSpread),
+		Timestamp:             s.Timestamp,
+		Latitude:              s.Latitude,
+		Longitude:             s.Longitude,
+	}
+}
@@ -0,0 +1,135 @@
+// Package spotter reads data in the shape of the Sofar Spotter API, whose
+// wave data responses hold a buoy's waves, wind and surface temperature
+// readings along with its battery, solar and humidity values.
+package spotter
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"od-api/models"
+)
+
+var ErrNotObject = errors.New("expected a JSON object")
+
+// Data is the data object of a Spotter wave data response
+type Data struct {
+	SpotterID      string             `json:"spotterId"`
+	SpotterName    string             `json:"spotterName"`
+	PayloadType    string             `json:"payloadType"`
+	BatteryVoltage *float64           `json:"batteryVoltage"`
+	BatteryPower   *float64           `json:"batteryPower"`
+	SolarVoltage   *float64           `json:"solarVoltage"`
+	Humidity       *float64           `json:"humidity"`
+	Waves          []models.WavesData `json:"waves"`
+	Wind           []Wind             `json:"wind"`
+	SurfaceTemp    []SurfaceTemp      `json:"surfaceTemp"`
+}
+
+// Wind is a wind reading. Direction is where the wind blows from.
+type Wind struct {
+	Speed        float64          `json:"speed"`
+	Direction    float64          `json:"direction"`
+	SeasurfaceID int              `json:"seasurfaceId"`
+	Latitude     float64          `json:"latitude"`
+	Longitude    float64          `json:"longitude"`
+	Timestamp    models.Timestamp `json:"timestamp"`
+}
+
+// SurfaceTemp is a sea surface temperature reading in degrees Celsius
+type SurfaceTemp struct {
+	Degrees   float64          `json:"degrees"`
+	Latitude  float64          `json:"latitude"`
+	Longitude float64          `json:"longitude"`
+	Timestamp models.Timestamp `json:"timestamp"`
+}
+
+// Decode reads a Spotter payload, either a whole API response or just its
+// data object. It also returns the paths of the fields it does not know,
+// such as "data.frequencyData" or "waves[].foo", which are ignored.
+func Decode(body []byte) (Data, []string, error) {
+	var data Data
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return data, nil, ErrNotObject
+	}
+
+	var unknown []string
+	prefix := ""
+	if inner, ok := fields["data"]; ok {
+		for name := range fields {
+			if name != "data" {
+				unknown = append(unknown, name)
+			}
+		}
+		body, prefix = inner, "data."
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return data, nil, err
+	}
+	unknown = append(unknown, unknownFields(body, reflect.TypeOf(data), prefix)...)
+	sort.Strings(unknown)
+	return data, unknown, nil
+}
+
+// List the fields of a JSON object that have no counterpart in a struct,
+// looking into arrays of structs. Array elements share a path.
+func unknownFields(raw json.RawMessage, t reflect.Type, prefix string) []string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+
+	known := structFields(t)
+	seen := map[string]bool{}
+	var unknown []string
+	for name, value := range fields {
+		field, ok := known[name]
+		if !ok {
+			unknown = append(unknown, prefix+name)
+			continue
+		}
+		if field.Kind() != reflect.Slice || field.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		var items []json.RawMessage
+		json.Unmarshal(value, &items)
+		for _, item := range items {
+			for _, path := range unknownFields(item, field.Elem(), prefix+name+"[].") {
+				if !seen[path] {
+					seen[path] = true
+					unknown = append(unknown, path)
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// Map the JSON names of a struct's fields, including embedded ones, to their
+// types
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			for name, typ := range structFields(f.Type) {
+				fields[name] = typ
+			}
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		if name != "-" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Top-level buckets of the embedded database. Documents are stored as BSON,
+// keyed by their 12 byte ObjectID, so they can be exported to Mongo as-is.
+// The waves, telemetry and spectra buckets hold one nested bucket of records per
+// buoy, keyed by boltRecordKey. The observations bucket nests one more
+// level, by payload type. The alerts, statusEvents and driftEvents buckets are
+// keyed by boltRecordKey.
+var (
+	boltBuoysBucket        = []byte("buoys")
+	boltWavesBucket        = []byte("waves")
+	boltTelemetryBucket    = []byte("telemetry")
+	boltSpectraBucket      = []byte("spectra")
+	boltObservationsBucket = []byte("observations")
+	boltUsersBucket        = []byte("users")
+	boltAlertRulesBucket   = []byte("alertRules")
+	boltAlertsBucket       = []byte("alerts")
+	boltWebhooksBucket     = []byte("webhooks")
+	boltDeadLettersBucket  = []byte("deadLetters")
+	boltStatusEventsBucket = []byte("statusEvents")
+	boltDriftEventsBucket  = []byte("driftEvents")
+
+	boltCollections = [][]byte{boltBuoysBucket, boltWavesBucket, boltTelemetryBucket, boltSpectraBucket, boltObservationsBucket, boltUsersBucket, boltAlertRulesBucket, boltAlertsBucket, boltWebhooksBucket, boltDeadLettersBucket, boltStatusEventsBucket, boltDriftEventsBucket}
+)
+
+// OpenBolt opens or creates the single-file database used by the bolt
+// storage backend.
+func OpenBolt(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range boltCollections {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func boltPut(bucket *bbolt.Bucket, key []byte, doc interface{}) error {
+	value, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+// Decode a stored document, returning ErrNotFound if the key is missing
+func boltGet(bucket *bbolt.Bucket, key []byte, doc interface{}) error {
+	value := bucket.Get(key)
+	if value == nil {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(value, doc)
+}
+
+// ExportBolt writes each collection of a bolt database (buoys, waves,
+// telemetry, spectra, observations, users, alertRules, alerts, webhooks, deadLetters, statusEvents and driftEvents) to <collection>.json in dir, one canonical Extended
+// JSON document per line, ready for mongoimport.
+func ExportBolt(db *bbolt.DB, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return db.View(func(tx *bbolt.Tx) error {
+		for _, name := range boltCollections {
+			if err := exportBucket(filepath.Join(dir, string(name)+".json"), tx.Bucket(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Write the documents of a bucket and of its nested buckets to a file
+func exportBucket(path string, bucket *bbolt.Bucket) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+
+	var writeDocs func(bucket *bbolt.Bucket) error
+	writeDocs = func(bucket *bbolt.Bucket) error {
+		return bucket.ForEach(func(key, value []byte) error {
+			if value == nil {
+				return writeDocs(bucket.Bucket(key))
+			}
+			line, err := bson.MarshalExtJSON(bson.Raw(value), true, false)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(append(line, '\n'))
+			return err
+		})
+	}
+
+	if err := writeDocs(bucket); err != nil {
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
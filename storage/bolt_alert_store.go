@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltAlertStore keeps alert rules and alerts in an embedded bbolt database
+// file. Alerts are keyed by boltRecordKey in a single bucket.
+type BoltAlertStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltAlertStore(db *bbolt.DB) *BoltAlertStore {
+	return &BoltAlertStore{db: db}
+}
+
+func (s *BoltAlertStore) CreateRule(ctx context.Context, rule models.AlertRule) (primitive.ObjectID, error) {
+	rule.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltAlertRulesBucket), rule.ID[:], rule)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return rule.ID, nil
+}
+
+func (s *BoltAlertStore) GetRule(ctx context.Context, id primitive.ObjectID) (models.AlertRule, error) {
+	var rule models.AlertRule
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(boltAlertRulesBucket), id[:], &rule)
+	})
+	return rule, err
+}
+
+func (s *BoltAlertStore) UpdateRule(ctx context.Context, id primitive.ObjectID, rule models.AlertRule) (models.AlertRule, error) {
+	rule.ID = id
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		rules := tx.Bucket(boltAlertRulesBucket)
+		if rules.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return boltPut(rules, id[:], rule)
+	})
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (s *BoltAlertStore) DeleteRule(ctx context.Context, id primitive.ObjectID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		rules := tx.Bucket(boltAlertRulesBucket)
+		if rules.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return rules.Delete(id[:])
+	})
+}
+
+func (s *BoltAlertStore) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	rules := []models.AlertRule{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltAlertRulesBucket).ForEach(func(_, value []byte) error {
+			var rule models.AlertRule
+			if err := bson.Unmarshal(value, &rule); err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+			return nil
+		})
+	})
+	return rules, err
+}
+
+func (s *BoltAlertStore) AddAlert(ctx context.Context, alert models.Alert) (primitive.ObjectID, error) {
+	alert.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltAlertsBucket), boltRecordKey(alertKey(alert)), alert)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return alert.ID, nil
+}
+
+func (s *BoltAlertStore) QueryAlerts(ctx context.Context, filter AlertFilter, query RangeQuery) ([]models.Alert, error) {
+	alerts := []models.Alert{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltAlertsBucket).Cursor()
+		var k, value []byte
+		switch {
+		case query.After != nil:
+			k, value = c.Seek(boltRecordKey(*query.After))
+		case !query.From.IsZero():
+			k, value = c.Seek(boltRecordKey(RangeCursor{Timestamp: query.From}))
+		default:
+			k, value = c.First()
+		}
+
+		for ; k != nil; k, value = c.Next() {
+			var alert models.Alert
+			if err := bson.Unmarshal(value, &alert); err != nil {
+				return err
+			}
+			if !query.To.IsZero() && alert.Timestamp.After(query.To) {
+				break
+			}
+			if !filter.matches(alert) || !query.contains(alertKey(alert)) {
+				continue
+			}
+			alerts = append(alerts, alert)
+			if query.Limit > 0 && int64(len(alerts)) == query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return alerts, err
+}
+
+func (s *BoltAlertStore) LatestAlert(ctx context.Context, ruleID, buoyID primitive.ObjectID) (models.Alert, error) {
+	var latest models.Alert
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		filter := AlertFilter{RuleID: ruleID, BuoyID: buoyID}
+		c := tx.Bucket(boltAlertsBucket).Cursor()
+		for k, value := c.Last(); k != nil; k, value = c.Prev() {
+			var alert models.Alert
+			if err := bson.Unmarshal(value, &alert); err != nil {
+				return err
+			}
+			if filter.matches(alert) {
+				latest = alert
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return latest, err
+}
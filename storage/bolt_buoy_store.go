@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltBuoyStore keeps buoys and readings in an embedded bbolt database file,
+// for stations that have no Mongo server.
+type BoltBuoyStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltBuoyStore(db *bbolt.DB) *BoltBuoyStore {
+	return &BoltBuoyStore{db: db}
+}
+
+func (s *BoltBuoyStore) CreateBuoy(ctx context.Context, buoy models.Buoy) (primitive.ObjectID, error) {
+	buoy.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltBuoysBucket), buoy.ID[:], buoy)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return buoy.ID, nil
+}
+
+func (s *BoltBuoyStore) GetBuoy(ctx context.Context, id primitive.ObjectID) (models.Buoy, error) {
+	var buoy models.Buoy
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(boltBuoysBucket), id[:], &buoy)
+	})
+	return buoy, err
+}
+
+func (s *BoltBuoyStore) UpdateBuoy(ctx context.Context, id primitive.ObjectID, buoy models.Buoy) (models.Buoy, error) {
+	var existing models.Buoy
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		if err := boltGet(buoys, id[:], &existing); err != nil {
+			return err
+		}
+		existing.BuoyName = buoy.BuoyName
+		existing.Location = buoy.Location
+		existing.PayloadType = buoy.PayloadType
+		existing.Payloads = buoy.Payloads
+		existing.Groups = buoy.Groups
+		existing.ReportInterval = buoy.ReportInterval
+		existing.Anchor = buoy.Anchor
+		existing.WatchRadius = buoy.WatchRadius
+		existing.Simulated = buoy.Simulated
+		return boltPut(buoys, id[:], existing)
+	})
+	return existing, err
+}
+
+func (s *BoltBuoyStore) DeleteBuoy(ctx context.Context, id primitive.ObjectID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		if buoys.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		if err := buoys.Delete(id[:]); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{boltWavesBucket, boltTelemetryBucket, boltSpectraBucket, boltObservationsBucket} {
+			err := tx.Bucket(name).DeleteBucket(id[:])
+			if err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltBuoyStore) ListBuoys(ctx context.Context) ([]models.Buoy, error) {
+	buoys := []models.Buoy{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBuoysBucket).ForEach(func(_, value []byte) error {
+			var buoy models.Buoy
+			if err := bson.Unmarshal(value, &buoy); err != nil {
+				return err
+			}
+			buoys = append(buoys, buoy)
+			return nil
+		})
+	})
+	return buoys, err
+}
+
+func (s *BoltBuoyStore) BuoysNear(ctx context.Context, lat, lon, radiusKm float64) ([]NearbyBuoy, error) {
+	buoys, err := s.ListBuoys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nearbyBuoys(buoys, lat, lon, radiusKm), nil
+}
+
+func (s *BoltBuoyStore) BuoysWithin(ctx context.Context, bbox BBox) ([]models.Buoy, error) {
+	buoys, err := s.ListBuoys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	within := []models.Buoy{}
+	for _, buoy := range buoys {
+		if bbox.Contains(buoy.Position) {
+			within = append(within, buoy)
+		}
+	}
+	return within, nil
+}
+
+func (s *BoltBuoyStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	if len(waves) == 0 {
+		return nil, nil
+	}
+
+	duplicate := make([]bool, len(waves))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		var buoy models.Buoy
+		if err := boltGet(buoys, id[:], &buoy); err != nil {
+			return err
+		}
+
+		readings, err := tx.Bucket(boltWavesBucket).CreateBucketIfNotExists(id[:])
+		if err != nil {
+			return err
+		}
+		var stored []models.WavesData
+		for i, w := range waves {
+			// Keys and stored dates both have millisecond precision
+			w.Timestamp = models.NewTimestamp(w.Timestamp.Truncate(time.Millisecond))
+			if boltHasTimestamp(readings, w.Timestamp.Time) {
+				duplicate[i] = true
+				continue
+			}
+			stored = append(stored, w)
+
+			observation := models.WaveObservation{ID: primitive.NewObjectID(), BuoyID: id, WavesData: w}
+			if err := boltPut(readings, boltRecordKey(waveKey(observation)), observation); err != nil {
+				return err
+			}
+		}
+
+		if len(stored) == 0 {
+			return nil
+		}
+		advancePosition(&buoy, stored)
+		advanceLastReport(&buoy, latestWaves(stored).Timestamp)
+		return boltPut(buoys, id[:], buoy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicate, nil
+}
+
+func (s *BoltBuoyStore) RecentWaves(ctx context.Context, id primitive.ObjectID, limit int64) ([]models.WavesData, error) {
+	var observations []models.WaveObservation
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		observations, err = boltRecent[models.WaveObservation](tx.Bucket(boltWavesBucket).Bucket(id[:]), limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	waves := make([]models.WavesData, len(observations))
+	for i, o := range observations {
+		waves[i] = o.WavesData
+	}
+	return waves, nil
+}
+
+func (s *BoltBuoyStore) QueryWaves(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.WaveObservation, error) {
+	var observations []models.WaveObservation
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		observations, err = boltQueryRange(tx.Bucket(boltWavesBucket).Bucket(id[:]), waveKey, query)
+		return err
+	})
+	return observations, err
+}
+
+func (s *BoltBuoyStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	duplicate := make([]bool, len(records))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		var buoy models.Buoy
+		if err := boltGet(buoys, id[:], &buoy); err != nil {
+			return err
+		}
+
+		bucket, err := tx.Bucket(boltTelemetryBucket).CreateBucketIfNotExists(id[:])
+		if err != nil {
+			return err
+		}
+		var stored []models.TelemetryRecord
+		for i, r := range records {
+			r.Timestamp = models.NewTimestamp(r.Timestamp.Truncate(time.Millisecond))
+			if boltHasTimestamp(bucket, r.Timestamp.Time) {
+				duplicate[i] = true
+				continue
+			}
+			stored = append(stored, r)
+
+			observation := models.TelemetryObservation{ID: primitive.NewObjectID(), BuoyID: id, TelemetryRecord: r}
+			if err := boltPut(bucket, boltRecordKey(telemetryKey(observation)), observation); err != nil {
+				return err
+			}
+		}
+
+		if len(stored) == 0 {
+			return nil
+		}
+		advanceTelemetry(&buoy, stored)
+		advanceLastReport(&buoy, latestTelemetry(stored).Timestamp)
+		return boltPut(buoys, id[:], buoy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicate, nil
+}
+
+func (s *BoltBuoyStore) QueryTelemetry(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.TelemetryObservation, error) {
+	var observations []models.TelemetryObservation
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		observations, err = boltQueryRange(tx.Bucket(boltTelemetryBucket).Bucket(id[:]), telemetryKey, query)
+		return err
+	})
+	return observations, err
+}
+
+func (s *BoltBuoyStore) AddSpectra(ctx context.Context, id primitive.ObjectID, spectra ...models.WaveSpectrum) ([]bool, error) {
+	if len(spectra) == 0 {
+		return nil, nil
+	}
+
+	duplicate := make([]bool, len(spectra))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		var buoy models.Buoy
+		if err := boltGet(buoys, id[:], &buoy); err != nil {
+			return err
+		}
+
+		bucket, err := tx.Bucket(boltSpectraBucket).CreateBucketIfNotExists(id[:])
+		if err != nil {
+			return err
+		}
+		for i, spectrum := range spectra {
+			spectrum.Timestamp = models.NewTimestamp(spectrum.Timestamp.Truncate(time.Millisecond))
+			if boltHasTimestamp(bucket, spectrum.Timestamp.Time) {
+				duplicate[i] = true
+				continue
+			}
+			observation := models.SpectrumObservation{ID: primitive.NewObjectID(), BuoyID: id, WaveSpectrum: spectrum}
+			if err := boltPut(bucket, boltRecordKey(spectrumKey(observation)), observation); err != nil {
+				return err
+			}
+			advanceLastReport(&buoy, spectrum.Timestamp)
+		}
+		return boltPut(buoys, id[:], buoy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicate, nil
+}
+
+func (s *BoltBuoyStore) QuerySpectra(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.SpectrumObservation, error) {
+	var observations []models.SpectrumObservation
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		observations, err = boltQueryRange(tx.Bucket(boltSpectraBucket).Bucket(id[:]), spectrumKey, query)
+		return err
+	})
+	return observations, err
+}
+
+func (s *BoltBuoyStore) AddObservations(ctx context.Context, id primitive.ObjectID, payload string, observations ...models.Observation) ([]bool, error) {
+	if len(observations) == 0 {
+		return nil, nil
+	}
+
+	duplicate := make([]bool, len(observations))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		buoys := tx.Bucket(boltBuoysBucket)
+		var buoy models.Buoy
+		if err := boltGet(buoys, id[:], &buoy); err != nil {
+			return err
+		}
+
+		payloads, err := tx.Bucket(boltObservationsBucket).CreateBucketIfNotExists(id[:])
+		if err != nil {
+			return err
+		}
+		bucket, err := payloads.CreateBucketIfNotExists([]byte(payload))
+		if err != nil {
+			return err
+		}
+		for i, o := range observations {
+			o.Timestamp = models.NewTimestamp(o.Timestamp.Truncate(time.Millisecond))
+			if boltHasTimestamp(bucket, o.Timestamp.Time) {
+				duplicate[i] = true
+				continue
+			}
+			observation := models.PayloadObservation{ID: primitive.NewObjectID(), BuoyID: id, Payload: payload, Observation: o}
+			if err := boltPut(bucket, boltRecordKey(observationKey(observation)), observation); err != nil {
+				return err
+			}
+			advanceLastReport(&buoy, o.Timestamp)
+		}
+		return boltPut(buoys, id[:], buoy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicate, nil
+}
+
+func (s *BoltBuoyStore) QueryObservations(ctx context.Context, id primitive.ObjectID, payload string, query RangeQuery) ([]models.PayloadObservation, error) {
+	var observations []models.PayloadObservation
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var bucket *bbolt.Bucket
+		if payloads := tx.Bucket(boltObservationsBucket).Bucket(id[:]); payloads != nil {
+			bucket = payloads.Bucket([]byte(payload))
+		}
+
+		var err error
+		observations, err = boltQueryRange(bucket, observationKey, query)
+		return err
+	})
+	return observations, err
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltDriftStore keeps drift events in an embedded bbolt database file
+type BoltDriftStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltDriftStore(db *bbolt.DB) *BoltDriftStore {
+	return &BoltDriftStore{db: db}
+}
+
+func (s *BoltDriftStore) AddDriftEvent(ctx context.Context, event models.DriftEvent) (primitive.ObjectID, error) {
+	event.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltDriftEventsBucket), boltRecordKey(driftEventKey(event)), event)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return event.ID, nil
+}
+
+func (s *BoltDriftStore) QueryDriftEvents(ctx context.Context, filter DriftEventFilter, query RangeQuery) ([]models.DriftEvent, error) {
+	events := []models.DriftEvent{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltDriftEventsBucket).Cursor()
+		var k, value []byte
+		switch {
+		case query.After != nil:
+			k, value = c.Seek(boltRecordKey(*query.After))
+		case !query.From.IsZero():
+			k, value = c.Seek(boltRecordKey(RangeCursor{Timestamp: query.From}))
+		default:
+			k, value = c.First()
+		}
+
+		for ; k != nil; k, value = c.Next() {
+			var event models.DriftEvent
+			if err := bson.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if !query.To.IsZero() && event.Timestamp.After(query.To) {
+				break
+			}
+			if !filter.matches(event) || !query.contains(driftEventKey(event)) {
+				continue
+			}
+			events = append(events, event)
+			if query.Limit > 0 && int64(len(events)) == query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (s *BoltDriftStore) LatestDriftEvent(ctx context.Context, buoyID primitive.ObjectID) (models.DriftEvent, error) {
+	var latest models.DriftEvent
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltDriftEventsBucket).Cursor()
+		for k, value := c.Last(); k != nil; k, value = c.Prev() {
+			var event models.DriftEvent
+			if err := bson.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if event.BuoyID == buoyID {
+				latest = event
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return latest, err
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltStatusStore keeps status events in an embedded bbolt database file
+type BoltStatusStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltStatusStore(db *bbolt.DB) *BoltStatusStore {
+	return &BoltStatusStore{db: db}
+}
+
+func (s *BoltStatusStore) AddStatusEvent(ctx context.Context, event models.StatusEvent) (primitive.ObjectID, error) {
+	event.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltStatusEventsBucket), boltRecordKey(statusEventKey(event)), event)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return event.ID, nil
+}
+
+func (s *BoltStatusStore) QueryStatusEvents(ctx context.Context, filter StatusEventFilter, query RangeQuery) ([]models.StatusEvent, error) {
+	events := []models.StatusEvent{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltStatusEventsBucket).Cursor()
+		var k, value []byte
+		switch {
+		case query.After != nil:
+			k, value = c.Seek(boltRecordKey(*query.After))
+		case !query.From.IsZero():
+			k, value = c.Seek(boltRecordKey(RangeCursor{Timestamp: query.From}))
+		default:
+			k, value = c.First()
+		}
+
+		for ; k != nil; k, value = c.Next() {
+			var event models.StatusEvent
+			if err := bson.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if !query.To.IsZero() && event.Timestamp.After(query.To) {
+				break
+			}
+			if !filter.matches(event) || !query.contains(statusEventKey(event)) {
+				continue
+			}
+			events = append(events, event)
+			if query.Limit > 0 && int64(len(events)) == query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (s *BoltStatusStore) LatestStatusEvent(ctx context.Context, buoyID primitive.ObjectID) (models.StatusEvent, error) {
+	var latest models.StatusEvent
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltStatusEventsBucket).Cursor()
+		for k, value := c.Last(); k != nil; k, value = c.Prev() {
+			var event models.StatusEvent
+			if err := bson.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if event.BuoyID == buoyID {
+				latest = event
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return latest, err
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltUserStore keeps users in an embedded bbolt database file
+type BoltUserStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltUserStore(db *bbolt.DB) *BoltUserStore {
+	return &BoltUserStore{db: db}
+}
+
+func (s *BoltUserStore) CreateUser(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	user.Id = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltUsersBucket), user.Id[:], user)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return user.Id, nil
+}
+
+func (s *BoltUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(boltUsersBucket), id[:], &user)
+	})
+	return user, err
+}
+
+func (s *BoltUserStore) UpdateUser(ctx context.Context, id primitive.ObjectID, user models.User) (models.User, error) {
+	user.Id = id
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(boltUsersBucket)
+		if users.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return boltPut(users, id[:], user)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (s *BoltUserStore) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(boltUsersBucket)
+		if users.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return users.Delete(id[:])
+	})
+}
+
+func (s *BoltUserStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).ForEach(func(_, value []byte) error {
+			var user models.User
+			if err := bson.Unmarshal(value, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
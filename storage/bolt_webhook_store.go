@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// BoltWebhookStore keeps webhooks and dead letters in an embedded bbolt
+// database file
+type BoltWebhookStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltWebhookStore(db *bbolt.DB) *BoltWebhookStore {
+	return &BoltWebhookStore{db: db}
+}
+
+func (s *BoltWebhookStore) CreateWebhook(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error) {
+	webhook.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltWebhooksBucket), webhook.ID[:], webhook)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return webhook.ID, nil
+}
+
+func (s *BoltWebhookStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(boltWebhooksBucket), id[:], &webhook)
+	})
+	return webhook, err
+}
+
+func (s *BoltWebhookStore) UpdateWebhook(ctx context.Context, id primitive.ObjectID, webhook models.Webhook) (models.Webhook, error) {
+	webhook.ID = id
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		webhooks := tx.Bucket(boltWebhooksBucket)
+		if webhooks.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return boltPut(webhooks, id[:], webhook)
+	})
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (s *BoltWebhookStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		webhooks := tx.Bucket(boltWebhooksBucket)
+		if webhooks.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		if err := webhooks.Delete(id[:]); err != nil {
+			return err
+		}
+
+		letters := tx.Bucket(boltDeadLettersBucket)
+		var keys [][]byte
+		err := letters.ForEach(func(key, value []byte) error {
+			var letter models.DeadLetter
+			if err := bson.Unmarshal(value, &letter); err != nil {
+				return err
+			}
+			if letter.WebhookID == id {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Keys are deleted after the walk, as bbolt cursors do not allow
+		// deleting while iterating
+		for _, key := range keys {
+			if err := letters.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltWebhookStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltWebhooksBucket).ForEach(func(_, value []byte) error {
+			var webhook models.Webhook
+			if err := bson.Unmarshal(value, &webhook); err != nil {
+				return err
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	return webhooks, err
+}
+
+func (s *BoltWebhookStore) AddDeadLetter(ctx context.Context, letter models.DeadLetter) (primitive.ObjectID, error) {
+	letter.ID = primitive.NewObjectID()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltDeadLettersBucket), letter.ID[:], letter)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return letter.ID, nil
+}
+
+func (s *BoltWebhookStore) GetDeadLetter(ctx context.Context, id primitive.ObjectID) (models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(boltDeadLettersBucket), id[:], &letter)
+	})
+	return letter, err
+}
+
+func (s *BoltWebhookStore) ListDeadLetters(ctx context.Context, webhookID primitive.ObjectID) ([]models.DeadLetter, error) {
+	letters := []models.DeadLetter{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltDeadLettersBucket).ForEach(func(_, value []byte) error {
+			var letter models.DeadLetter
+			if err := bson.Unmarshal(value, &letter); err != nil {
+				return err
+			}
+			if letter.WebhookID == webhookID {
+				letters = append(letters, letter)
+			}
+			return nil
+		})
+	})
+	return letters, err
+}
+
+func (s *BoltWebhookStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		letters := tx.Bucket(boltDeadLettersBucket)
+		if letters.Get(id[:]) == nil {
+			return ErrNotFound
+		}
+		return letters.Delete(id[:])
+	})
+}
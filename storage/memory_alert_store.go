@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryAlertStore keeps alert rules and alerts in process memory
+type MemoryAlertStore struct {
+	mu    sync.RWMutex
+	rules map[primitive.ObjectID]models.AlertRule
+	// Kept sorted by timestamp then ID
+	alerts []models.Alert
+}
+
+func NewMemoryAlertStore() *MemoryAlertStore {
+	return &MemoryAlertStore{rules: map[primitive.ObjectID]models.AlertRule{}}
+}
+
+func (s *MemoryAlertStore) CreateRule(ctx context.Context, rule models.AlertRule) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule.ID = primitive.NewObjectID()
+	s.rules[rule.ID] = rule
+	return rule.ID, nil
+}
+
+func (s *MemoryAlertStore) GetRule(ctx context.Context, id primitive.ObjectID) (models.AlertRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return models.AlertRule{}, ErrNotFound
+	}
+	return rule, nil
+}
+
+func (s *MemoryAlertStore) UpdateRule(ctx context.Context, id primitive.ObjectID, rule models.AlertRule) (models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return models.AlertRule{}, ErrNotFound
+	}
+	rule.ID = id
+	s.rules[id] = rule
+	return rule, nil
+}
+
+func (s *MemoryAlertStore) DeleteRule(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+func (s *MemoryAlertStore) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := []models.AlertRule{}
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return bytes.Compare(rules[i].ID[:], rules[j].ID[:]) < 0 })
+	return rules, nil
+}
+
+func (s *MemoryAlertStore) AddAlert(ctx context.Context, alert models.Alert) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert.ID = primitive.NewObjectID()
+	at := sort.Search(len(s.alerts), func(i int) bool { return alertKey(alert).before(alertKey(s.alerts[i])) })
+	s.alerts = append(s.alerts, alert)
+	copy(s.alerts[at+1:], s.alerts[at:])
+	s.alerts[at] = alert
+	return alert.ID, nil
+}
+
+func (s *MemoryAlertStore) QueryAlerts(ctx context.Context, filter AlertFilter, query RangeQuery) ([]models.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	alerts := []models.Alert{}
+	for _, alert := range s.alerts {
+		if !query.To.IsZero() && alert.Timestamp.After(query.To) {
+			break
+		}
+		if !filter.matches(alert) || !query.contains(alertKey(alert)) {
+			continue
+		}
+		alerts = append(alerts, alert)
+		if query.Limit > 0 && int64(len(alerts)) == query.Limit {
+			break
+		}
+	}
+	return alerts, nil
+}
+
+func (s *MemoryAlertStore) LatestAlert(ctx context.Context, ruleID, buoyID primitive.ObjectID) (models.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filter := AlertFilter{RuleID: ruleID, BuoyID: buoyID}
+	for i := len(s.alerts) - 1; i >= 0; i-- {
+		if filter.matches(s.alerts[i]) {
+			return s.alerts[i], nil
+		}
+	}
+	return models.Alert{}, ErrNotFound
+}
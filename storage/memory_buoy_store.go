@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryBuoyStore keeps buoys and readings in process memory. It is meant
+// for local development and tests; nothing survives a restart.
+type MemoryBuoyStore struct {
+	mu    sync.RWMutex
+	buoys map[primitive.ObjectID]models.Buoy
+	// Readings of each buoy, kept sorted by timestamp then ID
+	waves     map[primitive.ObjectID][]models.WaveObservation
+	telemetry map[primitive.ObjectID][]models.TelemetryObservation
+	spectra   map[primitive.ObjectID][]models.SpectrumObservation
+	// Observations of each buoy by payload type
+	observations map[primitive.ObjectID]map[string][]models.PayloadObservation
+}
+
+func NewMemoryBuoyStore() *MemoryBuoyStore {
+	return &MemoryBuoyStore{
+		buoys:        map[primitive.ObjectID]models.Buoy{},
+		waves:        map[primitive.ObjectID][]models.WaveObservation{},
+		telemetry:    map[primitive.ObjectID][]models.TelemetryObservation{},
+		spectra:      map[primitive.ObjectID][]models.SpectrumObservation{},
+		observations: map[primitive.ObjectID]map[string][]models.PayloadObservation{},
+	}
+}
+
+func (s *MemoryBuoyStore) CreateBuoy(ctx context.Context, buoy models.Buoy) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buoy.ID = primitive.NewObjectID()
+	buoy.Waves = nil
+	s.buoys[buoy.ID] = buoy
+	return buoy.ID, nil
+}
+
+func (s *MemoryBuoyStore) GetBuoy(ctx context.Context, id primitive.ObjectID) (models.Buoy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buoy, ok := s.buoys[id]
+	if !ok {
+		return models.Buoy{}, ErrNotFound
+	}
+	return buoy, nil
+}
+
+func (s *MemoryBuoyStore) UpdateBuoy(ctx context.Context, id primitive.ObjectID, buoy models.Buoy) (models.Buoy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.buoys[id]
+	if !ok {
+		return models.Buoy{}, ErrNotFound
+	}
+	existing.BuoyName = buoy.BuoyName
+	existing.Location = buoy.Location
+	existing.PayloadType = buoy.PayloadType
+	existing.Payloads = buoy.Payloads
+	existing.Groups = buoy.Groups
+	existing.ReportInterval = buoy.ReportInterval
+	existing.Anchor = buoy.Anchor
+	existing.WatchRadius = buoy.WatchRadius
+	existing.Simulated = buoy.Simulated
+	s.buoys[id] = existing
+	return existing, nil
+}
+
+func (s *MemoryBuoyStore) DeleteBuoy(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buoys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.buoys, id)
+	delete(s.waves, id)
+	delete(s.telemetry, id)
+	delete(s.spectra, id)
+	delete(s.observations, id)
+	return nil
+}
+
+func (s *MemoryBuoyStore) ListBuoys(ctx context.Context) ([]models.Buoy, error) {
+	return s.filterBuoys(func(models.Buoy) bool { return true }), nil
+}
+
+func (s *MemoryBuoyStore) BuoysNear(ctx context.Context, lat, lon, radiusKm float64) ([]NearbyBuoy, error) {
+	buoys, _ := s.ListBuoys(ctx)
+	return nearbyBuoys(buoys, lat, lon, radiusKm), nil
+}
+
+func (s *MemoryBuoyStore) BuoysWithin(ctx context.Context, bbox BBox) ([]models.Buoy, error) {
+	return s.filterBuoys(func(buoy models.Buoy) bool { return bbox.Contains(buoy.Position) }), nil
+}
+
+// List buoys matching a predicate, in creation order
+func (s *MemoryBuoyStore) filterBuoys(match func(models.Buoy) bool) []models.Buoy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buoys := []models.Buoy{}
+	for _, buoy := range s.buoys {
+		if match(buoy) {
+			buoys = append(buoys, buoy)
+		}
+	}
+	sort.Slice(buoys, func(i, j int) bool { return bytes.Compare(buoys[i].ID[:], buoys[j].ID[:]) < 0 })
+	return buoys
+}
+
+func (s *MemoryBuoyStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	if len(waves) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buoy, ok := s.buoys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	stored := make([]models.WavesData, len(waves))
+	observations := make([]models.WaveObservation, len(waves))
+	for i, w := range waves {
+		// Same precision as the other backends
+		w.Timestamp = models.NewTimestamp(w.Timestamp.Truncate(time.Millisecond))
+		stored[i] = w
+		observations[i] = models.WaveObservation{ID: primitive.NewObjectID(), BuoyID: id, WavesData: w}
+	}
+	var duplicate []bool
+	s.waves[id], duplicate = memoryInsert(s.waves[id], waveKey, observations...)
+
+	if stored = inserted(stored, duplicate); len(stored) > 0 {
+		advancePosition(&buoy, stored)
+		advanceLastReport(&buoy, latestWaves(stored).Timestamp)
+		s.buoys[id] = buoy
+	}
+	return duplicate, nil
+}
+
+func (s *MemoryBuoyStore) RecentWaves(ctx context.Context, id primitive.ObjectID, limit int64) ([]models.WavesData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	observations := memoryRecent(s.waves[id], limit)
+	waves := make([]models.WavesData, len(observations))
+	for i, o := range observations {
+		waves[i] = o.WavesData
+	}
+	return waves, nil
+}
+
+func (s *MemoryBuoyStore) QueryWaves(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.WaveObservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memoryQueryRange(s.waves[id], waveKey, query), nil
+}
+
+func (s *MemoryBuoyStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buoy, ok := s.buoys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	stored := make([]models.TelemetryRecord, len(records))
+	observations := make([]models.TelemetryObservation, len(records))
+	for i, r := range records {
+		r.Timestamp = models.NewTimestamp(r.Timestamp.Truncate(time.Millisecond))
+		stored[i] = r
+		observations[i] = models.TelemetryObservation{ID: primitive.NewObjectID(), BuoyID: id, TelemetryRecord: r}
+	}
+	var duplicate []bool
+	s.telemetry[id], duplicate = memoryInsert(s.telemetry[id], telemetryKey, observations...)
+
+	if stored = inserted(stored, duplicate); len(stored) > 0 {
+		advanceTelemetry(&buoy, stored)
+		advanceLastReport(&buoy, latestTelemetry(stored).Timestamp)
+		s.buoys[id] = buoy
+	}
+	return duplicate, nil
+}
+
+func (s *MemoryBuoyStore) QueryTelemetry(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.TelemetryObservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memoryQueryRange(s.telemetry[id], telemetryKey, query), nil
+}
+
+func (s *MemoryBuoyStore) AddSpectra(ctx context.Context, id primitive.ObjectID, spectra ...models.WaveSpectrum) ([]bool, error) {
+	if len(spectra) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buoy, ok := s.buoys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	observations := make([]models.SpectrumObservation, 0, len(spectra))
+	for _, spectrum := range spectra {
+		spectrum.Timestamp = models.NewTimestamp(spectrum.Timestamp.Truncate(time.Millisecond))
+		observations = append(observations, models.SpectrumObservation{ID: primitive.NewObjectID(), BuoyID: id, WaveSpectrum: spectrum})
+	}
+	var duplicate []bool
+	s.spectra[id], duplicate = memoryInsert(s.spectra[id], spectrumKey, observations...)
+
+	for i, o := range observations {
+		if !duplicate[i] {
+			advanceLastReport(&buoy, o.Timestamp)
+		}
+	}
+	s.buoys[id] = buoy
+	return duplicate, nil
+}
+
+func (s *MemoryBuoyStore) QuerySpectra(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.SpectrumObservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memoryQueryRange(s.spectra[id], spectrumKey, query), nil
+}
+
+func (s *MemoryBuoyStore) AddObservations(ctx context.Context, id primitive.ObjectID, payload string, observations ...models.Observation) ([]bool, error) {
+	if len(observations) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buoy, ok := s.buoys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	records := make([]models.PayloadObservation, 0, len(observations))
+	for _, o := range observations {
+		o.Timestamp = models.NewTimestamp(o.Timestamp.Truncate(time.Millisecond))
+		records = append(records, models.PayloadObservation{ID: primitive.NewObjectID(), BuoyID: id, Payload: payload, Observation: o})
+	}
+	if s.observations[id] == nil {
+		s.observations[id] = map[string][]models.PayloadObservation{}
+	}
+	var duplicate []bool
+	s.observations[id][payload], duplicate = memoryInsert(s.observations[id][payload], observationKey, records...)
+
+	for i, r := range records {
+		if !duplicate[i] {
+			advanceLastReport(&buoy, r.Timestamp)
+		}
+	}
+	s.buoys[id] = buoy
+	return duplicate, nil
+}
+
+func (s *MemoryBuoyStore) QueryObservations(ctx context.Context, id primitive.ObjectID, payload string, query RangeQuery) ([]models.PayloadObservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memoryQueryRange(s.observations[id][payload], observationKey, query), nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryDriftStore keeps drift events in process memory
+type MemoryDriftStore struct {
+	mu sync.RWMutex
+	// Kept sorted by timestamp then ID
+	events []models.DriftEvent
+}
+
+func NewMemoryDriftStore() *MemoryDriftStore {
+	return &MemoryDriftStore{}
+}
+
+func (s *MemoryDriftStore) AddDriftEvent(ctx context.Context, event models.DriftEvent) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = primitive.NewObjectID()
+	at := sort.Search(len(s.events), func(i int) bool { return driftEventKey(event).before(driftEventKey(s.events[i])) })
+	s.events = append(s.events, event)
+	copy(s.events[at+1:], s.events[at:])
+	s.events[at] = event
+	return event.ID, nil
+}
+
+func (s *MemoryDriftStore) QueryDriftEvents(ctx context.Context, filter DriftEventFilter, query RangeQuery) ([]models.DriftEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []models.DriftEvent{}
+	for _, event := range s.events {
+		if !query.To.IsZero() && event.Timestamp.After(query.To) {
+			break
+		}
+		if !filter.matches(event) || !query.contains(driftEventKey(event)) {
+			continue
+		}
+		events = append(events, event)
+		if query.Limit > 0 && int64(len(events)) == query.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryDriftStore) LatestDriftEvent(ctx context.Context, buoyID primitive.ObjectID) (models.DriftEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].BuoyID == buoyID {
+			return s.events[i], nil
+		}
+	}
+	return models.DriftEvent{}, ErrNotFound
+}
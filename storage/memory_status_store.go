@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryStatusStore keeps status events in process memory
+type MemoryStatusStore struct {
+	mu sync.RWMutex
+	// Kept sorted by timestamp then ID
+	events []models.StatusEvent
+}
+
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{}
+}
+
+func (s *MemoryStatusStore) AddStatusEvent(ctx context.Context, event models.StatusEvent) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = primitive.NewObjectID()
+	at := sort.Search(len(s.events), func(i int) bool { return statusEventKey(event).before(statusEventKey(s.events[i])) })
+	s.events = append(s.events, event)
+	copy(s.events[at+1:], s.events[at:])
+	s.events[at] = event
+	return event.ID, nil
+}
+
+func (s *MemoryStatusStore) QueryStatusEvents(ctx context.Context, filter StatusEventFilter, query RangeQuery) ([]models.StatusEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []models.StatusEvent{}
+	for _, event := range s.events {
+		if !query.To.IsZero() && event.Timestamp.After(query.To) {
+			break
+		}
+		if !filter.matches(event) || !query.contains(statusEventKey(event)) {
+			continue
+		}
+		events = append(events, event)
+		if query.Limit > 0 && int64(len(events)) == query.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryStatusStore) LatestStatusEvent(ctx context.Context, buoyID primitive.ObjectID) (models.StatusEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].BuoyID == buoyID {
+			return s.events[i], nil
+		}
+	}
+	return models.StatusEvent{}, ErrNotFound
+}
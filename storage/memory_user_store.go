@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryUserStore keeps users in process memory
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: map[primitive.ObjectID]models.User{}}
+}
+
+func (s *MemoryUserStore) CreateUser(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.Id = primitive.NewObjectID()
+	s.users[user.Id] = user
+	return user.Id, nil
+}
+
+func (s *MemoryUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryUserStore) UpdateUser(ctx context.Context, id primitive.ObjectID, user models.User) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return models.User{}, ErrNotFound
+	}
+	user.Id = id
+	s.users[id] = user
+	return user, nil
+}
+
+func (s *MemoryUserStore) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryUserStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return bytes.Compare(users[i].Id[:], users[j].Id[:]) < 0 })
+	return users, nil
+}
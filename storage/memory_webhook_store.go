@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+)
+
+// MemoryWebhookStore keeps webhooks and dead letters in process memory
+type MemoryWebhookStore struct {
+	mu          sync.RWMutex
+	webhooks    map[primitive.ObjectID]models.Webhook
+	deadLetters map[primitive.ObjectID]models.DeadLetter
+}
+
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{
+		webhooks:    map[primitive.ObjectID]models.Webhook{},
+		deadLetters: map[primitive.ObjectID]models.DeadLetter{},
+	}
+}
+
+func (s *MemoryWebhookStore) CreateWebhook(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook.ID = primitive.NewObjectID()
+	s.webhooks[webhook.ID] = webhook
+	return webhook.ID, nil
+}
+
+func (s *MemoryWebhookStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return models.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (s *MemoryWebhookStore) UpdateWebhook(ctx context.Context, id primitive.ObjectID, webhook models.Webhook) (models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return models.Webhook{}, ErrNotFound
+	}
+	webhook.ID = id
+	s.webhooks[id] = webhook
+	return webhook, nil
+}
+
+func (s *MemoryWebhookStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.webhooks, id)
+	for letterID, letter := range s.deadLetters {
+		if letter.WebhookID == id {
+			delete(s.deadLetters, letterID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryWebhookStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return bytes.Compare(webhooks[i].ID[:], webhooks[j].ID[:]) < 0 })
+	return webhooks, nil
+}
+
+func (s *MemoryWebhookStore) AddDeadLetter(ctx context.Context, letter models.DeadLetter) (primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter.ID = primitive.NewObjectID()
+	s.deadLetters[letter.ID] = letter
+	return letter.ID, nil
+}
+
+func (s *MemoryWebhookStore) GetDeadLetter(ctx context.Context, id primitive.ObjectID) (models.DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letter, ok := s.deadLetters[id]
+	if !ok {
+		return models.DeadLetter{}, ErrNotFound
+	}
+	return letter, nil
+}
+
+func (s *MemoryWebhookStore) ListDeadLetters(ctx context.Context, webhookID primitive.ObjectID) ([]models.DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letters := []models.DeadLetter{}
+	for _, letter := range s.deadLetters {
+		if letter.WebhookID == webhookID {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return bytes.Compare(letters[i].ID[:], letters[j].ID[:]) < 0 })
+	return letters, nil
+}
+
+func (s *MemoryWebhookStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deadLetters[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.deadLetters, id)
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoAlertStore keeps alert rules in the alertRules collection and alerts
+// in the alerts collection
+type MongoAlertStore struct {
+	rules  *mongo.Collection
+	alerts *mongo.Collection
+}
+
+func NewMongoAlertStore(client *mongo.Client) *MongoAlertStore {
+	return &MongoAlertStore{
+		rules:  configs.GetCollection(client, "alertRules"),
+		alerts: configs.GetCollection(client, "alerts"),
+	}
+}
+
+func (s *MongoAlertStore) CreateRule(ctx context.Context, rule models.AlertRule) (primitive.ObjectID, error) {
+	rule.ID = primitive.NewObjectID()
+	if _, err := s.rules.InsertOne(ctx, rule); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return rule.ID, nil
+}
+
+func (s *MongoAlertStore) GetRule(ctx context.Context, id primitive.ObjectID) (models.AlertRule, error) {
+	var rule models.AlertRule
+	err := s.rules.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return rule, ErrNotFound
+	}
+	return rule, err
+}
+
+func (s *MongoAlertStore) UpdateRule(ctx context.Context, id primitive.ObjectID, rule models.AlertRule) (models.AlertRule, error) {
+	rule.ID = id
+	result, err := s.rules.ReplaceOne(ctx, bson.M{"_id": id}, rule)
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.AlertRule{}, ErrNotFound
+	}
+	return rule, nil
+}
+
+func (s *MongoAlertStore) DeleteRule(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.rules.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoAlertStore) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	results, err := s.rules.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []models.AlertRule{}
+	err = results.All(ctx, &rules)
+	return rules, err
+}
+
+func (s *MongoAlertStore) AddAlert(ctx context.Context, alert models.Alert) (primitive.ObjectID, error) {
+	alert.ID = primitive.NewObjectID()
+	if _, err := s.alerts.InsertOne(ctx, alert); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return alert.ID, nil
+}
+
+func (s *MongoAlertStore) QueryAlerts(ctx context.Context, filter AlertFilter, query RangeQuery) ([]models.Alert, error) {
+	series := bson.M{}
+	if !filter.BuoyID.IsZero() {
+		series["buoyId"] = filter.BuoyID
+	}
+	if !filter.RuleID.IsZero() {
+		series["ruleId"] = filter.RuleID
+	}
+	if filter.State != "" {
+		series["state"] = filter.State
+	}
+	return mongoQueryRange[models.Alert](ctx, s.alerts, series, query)
+}
+
+func (s *MongoAlertStore) LatestAlert(ctx context.Context, ruleID, buoyID primitive.ObjectID) (models.Alert, error) {
+	var alert models.Alert
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	err := s.alerts.FindOne(ctx, bson.M{"ruleId": ruleID, "buoyId": buoyID}, opts).Decode(&alert)
+	if err == mongo.ErrNoDocuments {
+		return alert, ErrNotFound
+	}
+	return alert, err
+}
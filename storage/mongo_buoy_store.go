@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoBuoyStore keeps buoys in the buoys collection and their readings in
+// the waves, telemetry, spectra and observations collections, one document
+// per reading, so buoy documents do not grow with every sample.
+type MongoBuoyStore struct {
+	buoys        *mongo.Collection
+	waves        *mongo.Collection
+	telemetry    *mongo.Collection
+	spectra      *mongo.Collection
+	observations *mongo.Collection
+}
+
+func NewMongoBuoyStore(client *mongo.Client) *MongoBuoyStore {
+	return &MongoBuoyStore{
+		buoys:        configs.GetCollection(client, "buoys"),
+		waves:        configs.GetCollection(client, "waves"),
+		telemetry:    configs.GetCollection(client, "telemetry"),
+		spectra:      configs.GetCollection(client, "spectra"),
+		observations: configs.GetCollection(client, "observations"),
+	}
+}
+
+func (s *MongoBuoyStore) CreateBuoy(ctx context.Context, buoy models.Buoy) (primitive.ObjectID, error) {
+	buoy.ID = primitive.NewObjectID()
+	if _, err := s.buoys.InsertOne(ctx, buoy); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return buoy.ID, nil
+}
+
+func (s *MongoBuoyStore) GetBuoy(ctx context.Context, id primitive.ObjectID) (models.Buoy, error) {
+	var buoy models.Buoy
+	err := s.buoys.FindOne(ctx, bson.M{"_id": id}).Decode(&buoy)
+	if err == mongo.ErrNoDocuments {
+		return buoy, ErrNotFound
+	}
+	return buoy, err
+}
+
+func (s *MongoBuoyStore) UpdateBuoy(ctx context.Context, id primitive.ObjectID, buoy models.Buoy) (models.Buoy, error) {
+	// Buoy fields have no bson tags, so their keys are the lowercased field names
+	update := bson.M{
+		"buoyname":       buoy.BuoyName,
+		"location":       buoy.Location,
+		"payloadtype":    buoy.PayloadType,
+		"payloads":       buoy.Payloads,
+		"groups":         buoy.Groups,
+		"reportInterval": buoy.ReportInterval,
+		"anchor":         buoy.Anchor,
+		"watchRadius":    buoy.WatchRadius,
+		"simulated":      buoy.Simulated,
+	}
+
+	result, err := s.buoys.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	if err != nil {
+		return models.Buoy{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Buoy{}, ErrNotFound
+	}
+	return s.GetBuoy(ctx, id)
+}
+
+func (s *MongoBuoyStore) DeleteBuoy(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.buoys.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return ErrNotFound
+	}
+
+	for _, readings := range []*mongo.Collection{s.waves, s.telemetry, s.spectra, s.observations} {
+		if _, err := readings.DeleteMany(ctx, bson.M{"buoyId": id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MongoBuoyStore) ListBuoys(ctx context.Context) ([]models.Buoy, error) {
+	return s.findBuoys(ctx, bson.M{})
+}
+
+func (s *MongoBuoyStore) BuoysNear(ctx context.Context, lat, lon, radiusKm float64) ([]NearbyBuoy, error) {
+	// $geoNear sorts by distance and uses the 2dsphere index on position
+	pipeline := bson.A{
+		bson.M{"$geoNear": bson.M{
+			"near":               models.NewGeoPoint(lat, lon),
+			"key":                "position",
+			"distanceField":      "distanceKm",
+			"distanceMultiplier": 0.001,
+			"maxDistance":        radiusKm * 1000,
+			"spherical":          true,
+		}},
+	}
+	results, err := s.buoys.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	buoys := []NearbyBuoy{}
+	err = results.All(ctx, &buoys)
+	return buoys, err
+}
+
+func (s *MongoBuoyStore) BuoysWithin(ctx context.Context, bbox BBox) ([]models.Buoy, error) {
+	// $box matches on plain longitude/latitude ranges, which is what a
+	// bounding box means; a GeoJSON polygon would follow great circles
+	within := func(west, east float64) bson.M {
+		return bson.M{"position": bson.M{"$geoWithin": bson.M{
+			"$box": bson.A{bson.A{west, bbox.MinLat}, bson.A{east, bbox.MaxLat}},
+		}}}
+	}
+	filter := within(bbox.MinLon, bbox.MaxLon)
+	if bbox.MinLon > bbox.MaxLon {
+		filter = bson.M{"$or": bson.A{within(bbox.MinLon, 180), within(-180, bbox.MaxLon)}}
+	}
+
+	return s.findBuoys(ctx, filter)
+}
+
+func (s *MongoBuoyStore) findBuoys(ctx context.Context, filter bson.M) ([]models.Buoy, error) {
+	results, err := s.buoys.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	buoys := []models.Buoy{}
+	err = results.All(ctx, &buoys)
+	return buoys, err
+}
+
+func (s *MongoBuoyStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	if len(waves) == 0 {
+		return nil, nil
+	}
+
+	if err := s.checkBuoyExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, 0, len(waves))
+	for _, w := range waves {
+		docs = append(docs, models.WaveObservation{BuoyID: id, WavesData: w})
+	}
+	duplicate, err := mongoInsertNew(ctx, s.waves, docs)
+	if err != nil {
+		return nil, err
+	}
+	stored := inserted(waves, duplicate)
+	if len(stored) == 0 {
+		return duplicate, nil
+	}
+
+	// Only move the position forward in time
+	latest := latestWaves(stored)
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"positionTimestamp": bson.M{"$exists": false}},
+			bson.M{"positionTimestamp": bson.M{"$lte": latest.Timestamp}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"position":          models.NewGeoPoint(latest.Latitude, latest.Longitude),
+		"positionTimestamp": latest.Timestamp,
+	}}
+	if _, err := s.buoys.UpdateOne(ctx, filter, update); err != nil {
+		return duplicate, err
+	}
+	return duplicate, s.advanceLastReport(ctx, id, latest.Timestamp)
+}
+
+func (s *MongoBuoyStore) RecentWaves(ctx context.Context, id primitive.ObjectID, limit int64) ([]models.WavesData, error) {
+	observations, err := mongoRecent[models.WaveObservation](ctx, s.waves, bson.M{"buoyId": id}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	waves := make([]models.WavesData, len(observations))
+	for i, o := range observations {
+		waves[i] = o.WavesData
+	}
+	return waves, nil
+}
+
+func (s *MongoBuoyStore) QueryWaves(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.WaveObservation, error) {
+	return mongoQueryRange[models.WaveObservation](ctx, s.waves, bson.M{"buoyId": id}, query)
+}
+
+func (s *MongoBuoyStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	if err := s.checkBuoyExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, 0, len(records))
+	for _, r := range records {
+		docs = append(docs, models.TelemetryObservation{BuoyID: id, TelemetryRecord: r})
+	}
+	duplicate, err := mongoInsertNew(ctx, s.telemetry, docs)
+	if err != nil {
+		return nil, err
+	}
+	stored := inserted(records, duplicate)
+	if len(stored) == 0 {
+		return duplicate, nil
+	}
+
+	// Only move the snapshot forward in time
+	latest := latestTelemetry(stored)
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"telemetryTimestamp": bson.M{"$exists": false}},
+			bson.M{"telemetryTimestamp": bson.M{"$lte": latest.Timestamp}},
+		},
+	}
+	snapshot := bson.M{"telemetryTimestamp": latest.Timestamp}
+	if latest.BatteryVoltage != nil {
+		snapshot["batteryvoltage"] = *latest.BatteryVoltage
+	}
+	if latest.BatteryPower != nil {
+		snapshot["batterypower"] = *latest.BatteryPower
+	}
+	if latest.SolarVoltage != nil {
+		snapshot["solarvoltage"] = *latest.SolarVoltage
+	}
+	if latest.Humidity != nil {
+		snapshot["humidity"] = *latest.Humidity
+	}
+	if _, err := s.buoys.UpdateOne(ctx, filter, bson.M{"$set": snapshot}); err != nil {
+		return duplicate, err
+	}
+	return duplicate, s.advanceLastReport(ctx, id, latest.Timestamp)
+}
+
+func (s *MongoBuoyStore) QueryTelemetry(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.TelemetryObservation, error) {
+	return mongoQueryRange[models.TelemetryObservation](ctx, s.telemetry, bson.M{"buoyId": id}, query)
+}
+
+func (s *MongoBuoyStore) AddSpectra(ctx context.Context, id primitive.ObjectID, spectra ...models.WaveSpectrum) ([]bool, error) {
+	if len(spectra) == 0 {
+		return nil, nil
+	}
+
+	if err := s.checkBuoyExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, 0, len(spectra))
+	for _, spectrum := range spectra {
+		docs = append(docs, models.SpectrumObservation{BuoyID: id, WaveSpectrum: spectrum})
+	}
+	duplicate, err := mongoInsertNew(ctx, s.spectra, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := inserted(spectra, duplicate)
+	if len(stored) == 0 {
+		return duplicate, nil
+	}
+	latest := stored[0].Timestamp
+	for _, spectrum := range stored[1:] {
+		if spectrum.Timestamp.After(latest.Time) {
+			latest = spectrum.Timestamp
+		}
+	}
+	return duplicate, s.advanceLastReport(ctx, id, latest)
+}
+
+func (s *MongoBuoyStore) QuerySpectra(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.SpectrumObservation, error) {
+	return mongoQueryRange[models.SpectrumObservation](ctx, s.spectra, bson.M{"buoyId": id}, query)
+}
+
+func (s *MongoBuoyStore) AddObservations(ctx context.Context, id primitive.ObjectID, payload string, observations ...models.Observation) ([]bool, error) {
+	if len(observations) == 0 {
+		return nil, nil
+	}
+
+	if err := s.checkBuoyExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, 0, len(observations))
+	for _, o := range observations {
+		docs = append(docs, models.PayloadObservation{BuoyID: id, Payload: payload, Observation: o})
+	}
+	duplicate, err := mongoInsertNew(ctx, s.observations, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := inserted(observations, duplicate)
+	if len(stored) == 0 {
+		return duplicate, nil
+	}
+	latest := stored[0].Timestamp
+	for _, o := range stored[1:] {
+		if o.Timestamp.After(latest.Time) {
+			latest = o.Timestamp
+		}
+	}
+	return duplicate, s.advanceLastReport(ctx, id, latest)
+}
+
+func (s *MongoBuoyStore) QueryObservations(ctx context.Context, id primitive.ObjectID, payload string, query RangeQuery) ([]models.PayloadObservation, error) {
+	return mongoQueryRange[models.PayloadObservation](ctx, s.observations, bson.M{"buoyId": id, "payload": payload}, query)
+}
+
+// Move the buoy's last report time forward. $max leaves a later time as it
+// is.
+func (s *MongoBuoyStore) advanceLastReport(ctx context.Context, id primitive.ObjectID, timestamp models.Timestamp) error {
+	_, err := s.buoys.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$max": bson.M{"lastReportTimestamp": timestamp}})
+	return err
+}
+
+func (s *MongoBuoyStore) checkBuoyExists(ctx context.Context, id primitive.ObjectID) error {
+	count, err := s.buoys.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
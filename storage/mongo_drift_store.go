@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoDriftStore keeps drift events in the driftEvents collection
+type MongoDriftStore struct {
+	events *mongo.Collection
+}
+
+func NewMongoDriftStore(client *mongo.Client) *MongoDriftStore {
+	return &MongoDriftStore{events: configs.GetCollection(client, "driftEvents")}
+}
+
+func (s *MongoDriftStore) AddDriftEvent(ctx context.Context, event models.DriftEvent) (primitive.ObjectID, error) {
+	event.ID = primitive.NewObjectID()
+	if _, err := s.events.InsertOne(ctx, event); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return event.ID, nil
+}
+
+func (s *MongoDriftStore) QueryDriftEvents(ctx context.Context, filter DriftEventFilter, query RangeQuery) ([]models.DriftEvent, error) {
+	series := bson.M{}
+	if !filter.BuoyID.IsZero() {
+		series["buoyId"] = filter.BuoyID
+	}
+	if filter.State != "" {
+		series["state"] = filter.State
+	}
+	return mongoQueryRange[models.DriftEvent](ctx, s.events, series, query)
+}
+
+func (s *MongoDriftStore) LatestDriftEvent(ctx context.Context, buoyID primitive.ObjectID) (models.DriftEvent, error) {
+	var event models.DriftEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	err := s.events.FindOne(ctx, bson.M{"buoyId": buoyID}, opts).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return event, ErrNotFound
+	}
+	return event, err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoStatusStore keeps status events in the statusEvents collection
+type MongoStatusStore struct {
+	events *mongo.Collection
+}
+
+func NewMongoStatusStore(client *mongo.Client) *MongoStatusStore {
+	return &MongoStatusStore{events: configs.GetCollection(client, "statusEvents")}
+}
+
+func (s *MongoStatusStore) AddStatusEvent(ctx context.Context, event models.StatusEvent) (primitive.ObjectID, error) {
+	event.ID = primitive.NewObjectID()
+	if _, err := s.events.InsertOne(ctx, event); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return event.ID, nil
+}
+
+func (s *MongoStatusStore) QueryStatusEvents(ctx context.Context, filter StatusEventFilter, query RangeQuery) ([]models.StatusEvent, error) {
+	series := bson.M{}
+	if !filter.BuoyID.IsZero() {
+		series["buoyId"] = filter.BuoyID
+	}
+	if filter.Status != "" {
+		series["status"] = filter.Status
+	}
+	return mongoQueryRange[models.StatusEvent](ctx, s.events, series, query)
+}
+
+func (s *MongoStatusStore) LatestStatusEvent(ctx context.Context, buoyID primitive.ObjectID) (models.StatusEvent, error) {
+	var event models.StatusEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	err := s.events.FindOne(ctx, bson.M{"buoyId": buoyID}, opts).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return event, ErrNotFound
+	}
+	return event, err
+}
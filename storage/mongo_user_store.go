@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoUserStore keeps users in the users collection. Users are keyed by
+// their id field rather than _id.
+type MongoUserStore struct {
+	users *mongo.Collection
+}
+
+func NewMongoUserStore(client *mongo.Client) *MongoUserStore {
+	return &MongoUserStore{users: configs.GetCollection(client, "users")}
+}
+
+func (s *MongoUserStore) CreateUser(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	user.Id = primitive.NewObjectID()
+	if _, err := s.users.InsertOne(ctx, user); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return user.Id, nil
+}
+
+func (s *MongoUserStore) GetUser(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := s.users.FindOne(ctx, bson.M{"id": id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (s *MongoUserStore) UpdateUser(ctx context.Context, id primitive.ObjectID, user models.User) (models.User, error) {
+	update := bson.M{"name": user.Name, "location": user.Location, "title": user.Title}
+	result, err := s.users.UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": update})
+	if err != nil {
+		return models.User{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.User{}, ErrNotFound
+	}
+	return s.GetUser(ctx, id)
+}
+
+func (s *MongoUserStore) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.users.DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoUserStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	results, err := s.users.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []models.User{}
+	err = results.All(ctx, &users)
+	return users, err
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"od-api/configs"
+	"od-api/models"
+)
+
+// MongoWebhookStore keeps webhooks in the webhooks collection and dead
+// letters in the deadLetters collection
+type MongoWebhookStore struct {
+	webhooks    *mongo.Collection
+	deadLetters *mongo.Collection
+}
+
+func NewMongoWebhookStore(client *mongo.Client) *MongoWebhookStore {
+	return &MongoWebhookStore{
+		webhooks:    configs.GetCollection(client, "webhooks"),
+		deadLetters: configs.GetCollection(client, "deadLetters"),
+	}
+}
+
+func (s *MongoWebhookStore) CreateWebhook(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error) {
+	webhook.ID = primitive.NewObjectID()
+	if _, err := s.webhooks.InsertOne(ctx, webhook); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return webhook.ID, nil
+}
+
+func (s *MongoWebhookStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := s.webhooks.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return webhook, ErrNotFound
+	}
+	return webhook, err
+}
+
+func (s *MongoWebhookStore) UpdateWebhook(ctx context.Context, id primitive.ObjectID, webhook models.Webhook) (models.Webhook, error) {
+	webhook.ID = id
+	result, err := s.webhooks.ReplaceOne(ctx, bson.M{"_id": id}, webhook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (s *MongoWebhookStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.webhooks.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return ErrNotFound
+	}
+	_, err = s.deadLetters.DeleteMany(ctx, bson.M{"webhookId": id})
+	return err
+}
+
+func (s *MongoWebhookStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	results, err := s.webhooks.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	err = results.All(ctx, &webhooks)
+	return webhooks, err
+}
+
+func (s *MongoWebhookStore) AddDeadLetter(ctx context.Context, letter models.DeadLetter) (primitive.ObjectID, error) {
+	letter.ID = primitive.NewObjectID()
+	if _, err := s.deadLetters.InsertOne(ctx, letter); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return letter.ID, nil
+}
+
+func (s *MongoWebhookStore) GetDeadLetter(ctx context.Context, id primitive.ObjectID) (models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := s.deadLetters.FindOne(ctx, bson.M{"_id": id}).Decode(&letter)
+	if err == mongo.ErrNoDocuments {
+		return letter, ErrNotFound
+	}
+	return letter, err
+}
+
+func (s *MongoWebhookStore) ListDeadLetters(ctx context.Context, webhookID primitive.ObjectID) ([]models.DeadLetter, error) {
+	results, err := s.deadLetters.Find(ctx, bson.M{"webhookId": webhookID}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	letters := []models.DeadLetter{}
+	err = results.All(ctx, &letters)
+	return letters, err
+}
+
+func (s *MongoWebhookStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.deadLetters.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
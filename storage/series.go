@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Helpers shared by the time series a buoy keeps (waves readings, telemetry
+// records, ...). Records are ordered by timestamp, then by ID, which is what
+// a RangeCursor points into. Each helper takes the record's key function.
+// A series holds at most one record per timestamp, at millisecond precision
+// as stored in BSON dates; inserting another one at the same time is a
+// duplicate and is skipped.
+
+// Whether the position comes before another
+func (cur RangeCursor) before(other RangeCursor) bool {
+	if !cur.Timestamp.Equal(other.Timestamp) {
+		return cur.Timestamp.Before(other.Timestamp)
+	}
+	return bytes.Compare(cur.ID[:], other.ID[:]) < 0
+}
+
+// Whether a record key falls inside the query's time range
+func (query RangeQuery) contains(key RangeCursor) bool {
+	if !query.From.IsZero() && key.Timestamp.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && key.Timestamp.After(query.To) {
+		return false
+	}
+	return query.After == nil || query.After.before(key)
+}
+
+// Filter on the records of one series, such as {"buoyId": id}, in a range
+func mongoRangeFilter(series bson.M, query RangeQuery) bson.M {
+	filter := bson.M{}
+	for key, value := range series {
+		filter[key] = value
+	}
+	timestamp := bson.M{}
+	if !query.From.IsZero() {
+		timestamp["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		timestamp["$lte"] = query.To
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+	if query.After != nil {
+		// Continue strictly after the last record of the previous page
+		filter["$or"] = bson.A{
+			bson.M{"timestamp": bson.M{"$gt": query.After.Timestamp}},
+			bson.M{"timestamp": query.After.Timestamp, "_id": bson.M{"$gt": query.After.ID}},
+		}
+	}
+	return filter
+}
+
+// Records of a series in a Mongo collection keyed by timestamp
+func mongoQueryRange[T any](ctx context.Context, collection *mongo.Collection, series bson.M, query RangeQuery) ([]T, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(query.Limit)
+	}
+	results, err := collection.Find(ctx, mongoRangeFilter(series, query), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []T{}
+	err = results.All(ctx, &records)
+	return records, err
+}
+
+// Latest records of a series in a Mongo collection, oldest first
+func mongoRecent[T any](ctx context.Context, collection *mongo.Collection, series bson.M, limit int64) ([]T, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	results, err := collection.Find(ctx, series, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []T{}
+	if err := results.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	reverse(records)
+	return records, nil
+}
+
+// Insert the records of a Mongo series whose timestamp is not stored yet,
+// relying on the collection's unique index, and report which were duplicates
+func mongoInsertNew(ctx context.Context, collection *mongo.Collection, docs []interface{}) ([]bool, error) {
+	duplicate := make([]bool, len(docs))
+	_, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return nil, err
+			}
+			duplicate[writeErr.Index] = true
+		}
+		return duplicate, nil
+	}
+	return duplicate, err
+}
+
+// Insert records into a sorted in-memory series, skipping those whose
+// timestamp is already taken, and report which were duplicates
+func memoryInsert[T any](series []T, key func(T) RangeCursor, records ...T) ([]T, []bool) {
+	duplicate := make([]bool, len(records))
+	for i, record := range records {
+		t := key(record).Timestamp
+		at := sort.Search(len(series), func(j int) bool { return !key(series[j]).Timestamp.Before(t) })
+		if at < len(series) && key(series[at]).Timestamp.Equal(t) {
+			duplicate[i] = true
+			continue
+		}
+		series = append(series, record)
+		copy(series[at+1:], series[at:])
+		series[at] = record
+	}
+	return series, duplicate
+}
+
+func memoryQueryRange[T any](series []T, key func(T) RangeCursor, query RangeQuery) []T {
+	records := []T{}
+	for _, record := range series {
+		if !query.To.IsZero() && key(record).Timestamp.After(query.To) {
+			break
+		}
+		if !query.contains(key(record)) {
+			continue
+		}
+		records = append(records, record)
+		if query.Limit > 0 && int64(len(records)) == query.Limit {
+			break
+		}
+	}
+	return records
+}
+
+func memoryRecent[T any](series []T, limit int64) []T {
+	if int64(len(series)) > limit {
+		series = series[int64(len(series))-limit:]
+	}
+	return append([]T{}, series...)
+}
+
+// Bolt keys of records sort in time order: the millisecond timestamp with
+// the sign bit flipped, so times before 1970 sort first, then the ID
+func boltRecordKey(key RangeCursor) []byte {
+	k := make([]byte, 8+len(key.ID))
+	binary.BigEndian.PutUint64(k, uint64(key.Timestamp.UnixMilli())^(1<<63))
+	copy(k[8:], key.ID[:])
+	return k
+}
+
+// Whether a bolt bucket keyed by boltRecordKey has a record at a time
+func boltHasTimestamp(bucket *bbolt.Bucket, t time.Time) bool {
+	prefix := boltRecordKey(RangeCursor{Timestamp: t})[:8]
+	k, _ := bucket.Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// Records in a bolt bucket keyed by boltRecordKey
+func boltQueryRange[T any](bucket *bbolt.Bucket, key func(T) RangeCursor, query RangeQuery) ([]T, error) {
+	records := []T{}
+	if bucket == nil {
+		return records, nil
+	}
+
+	c := bucket.Cursor()
+	var k, value []byte
+	switch {
+	case query.After != nil:
+		k, value = c.Seek(boltRecordKey(*query.After))
+	case !query.From.IsZero():
+		k, value = c.Seek(boltRecordKey(RangeCursor{Timestamp: query.From}))
+	default:
+		k, value = c.First()
+	}
+
+	for ; k != nil; k, value = c.Next() {
+		var record T
+		if err := bson.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		if !query.To.IsZero() && key(record).Timestamp.After(query.To) {
+			break
+		}
+		if !query.contains(key(record)) {
+			continue
+		}
+		records = append(records, record)
+		if query.Limit > 0 && int64(len(records)) == query.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// Latest records in a bolt bucket keyed by boltRecordKey, oldest first
+func boltRecent[T any](bucket *bbolt.Bucket, limit int64) ([]T, error) {
+	records := []T{}
+	if bucket == nil {
+		return records, nil
+	}
+
+	c := bucket.Cursor()
+	for k, value := c.Last(); k != nil && int64(len(records)) < limit; k, value = c.Prev() {
+		var record T
+		if err := bson.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	reverse(records)
+	return records, nil
+}
+
+// Records that were not skipped as duplicates
+func inserted[T any](records []T, duplicate []bool) []T {
+	kept := make([]T, 0, len(records))
+	for i, record := range records {
+		if !duplicate[i] {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+func reverse[T any](records []T) {
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+}
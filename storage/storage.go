@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/geo"
+	"od-api/models"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Position in a time-ordered listing of a buoy's readings or records
+type RangeCursor struct {
+	Timestamp time.Time
+	ID        primitive.ObjectID
+}
+
+// RangeQuery selects a buoy's readings or records, oldest first. Zero From and To leave
+// the range open, After continues a previous page and a zero Limit returns
+// every matching reading.
+type RangeQuery struct {
+	From  time.Time
+	To    time.Time
+	After *RangeCursor
+	Limit int64
+}
+
+// BBox is a longitude/latitude box. MinLon is greater than MaxLon for boxes
+// crossing the antimeridian.
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Contains reports whether a point lies inside the box
+func (bbox BBox) Contains(p *models.GeoPoint) bool {
+	if p == nil {
+		return false
+	}
+	lon, lat := p.Coordinates[0], p.Coordinates[1]
+	if lat < bbox.MinLat || lat > bbox.MaxLat {
+		return false
+	}
+	if bbox.MinLon > bbox.MaxLon {
+		return lon >= bbox.MinLon || lon <= bbox.MaxLon
+	}
+	return lon >= bbox.MinLon && lon <= bbox.MaxLon
+}
+
+// NearbyBuoy is a buoy with its distance from a search point
+type NearbyBuoy struct {
+	models.Buoy `bson:",inline"`
+	DistanceKm  float64 `json:"distanceKm" bson:"distanceKm"`
+}
+
+// BuoyStore keeps buoys and their waves readings. Methods return ErrNotFound
+// when the buoy does not exist.
+//
+// A buoy has at most one reading of each kind per timestamp, at millisecond
+// precision. The Add methods skip readings whose timestamp is already stored
+// and report, for each one passed in, whether it was skipped as a duplicate.
+// Readings may arrive in any order; queries return them in time order. Each
+// Add method moves the buoy's last report time forward to the latest reading
+// it stores.
+type BuoyStore interface {
+	CreateBuoy(ctx context.Context, buoy models.Buoy) (primitive.ObjectID, error)
+	GetBuoy(ctx context.Context, id primitive.ObjectID) (models.Buoy, error)
+	// UpdateBuoy replaces the buoy's name, location, payloads, groups, report
+	// interval, anchor and watch radius and returns the result. Telemetry values only change through AddTelemetry.
+	UpdateBuoy(ctx context.Context, id primitive.ObjectID, buoy models.Buoy) (models.Buoy, error)
+	// DeleteBuoy removes the buoy and all of its readings and records
+	DeleteBuoy(ctx context.Context, id primitive.ObjectID) error
+	ListBuoys(ctx context.Context) ([]models.Buoy, error)
+	// BuoysNear lists buoys by last known position within radiusKm, closest first
+	BuoysNear(ctx context.Context, lat, lon, radiusKm float64) ([]NearbyBuoy, error)
+	BuoysWithin(ctx context.Context, bbox BBox) ([]models.Buoy, error)
+
+	// AddWaves stores readings and moves the buoy's last known position to
+	// the latest of them
+	AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error)
+	// RecentWaves returns the latest readings, oldest first
+	RecentWaves(ctx context.Context, id primitive.ObjectID, limit int64) ([]models.WavesData, error)
+	QueryWaves(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.WaveObservation, error)
+
+	// AddTelemetry stores housekeeping records and moves the buoy's battery,
+	// solar and humidity snapshot to the latest of them
+	AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error)
+	QueryTelemetry(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.TelemetryObservation, error)
+
+	// AddSpectra stores directional wave spectra. Their bulk parameters are
+	// stored separately, with AddWaves.
+	AddSpectra(ctx context.Context, id primitive.ObjectID, spectra ...models.WaveSpectrum) ([]bool, error)
+	QuerySpectra(ctx context.Context, id primitive.ObjectID, query RangeQuery) ([]models.SpectrumObservation, error)
+
+	// AddObservations stores readings of one of the buoy's payloads other
+	// than waves. Values are expected to be validated by the caller.
+	AddObservations(ctx context.Context, id primitive.ObjectID, payload string, observations ...models.Observation) ([]bool, error)
+	QueryObservations(ctx context.Context, id primitive.ObjectID, payload string, query RangeQuery) ([]models.PayloadObservation, error)
+}
+
+// UserStore keeps users. Methods return ErrNotFound when the user does not
+// exist.
+type UserStore interface {
+	CreateUser(ctx context.Context, user models.User) (primitive.ObjectID, error)
+	GetUser(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	// UpdateUser replaces the user's name, location and title and returns the result
+	UpdateUser(ctx context.Context, id primitive.ObjectID, user models.User) (models.User, error)
+	DeleteUser(ctx context.Context, id primitive.ObjectID) error
+	ListUsers(ctx context.Context) ([]models.User, error)
+}
+
+// AlertFilter selects alerts by buoy, rule and state. Zero fields match
+// any alert.
+type AlertFilter struct {
+	BuoyID primitive.ObjectID
+	RuleID primitive.ObjectID
+	State  string
+}
+
+func (f AlertFilter) matches(alert models.Alert) bool {
+	return (f.BuoyID.IsZero() || f.BuoyID == alert.BuoyID) &&
+		(f.RuleID.IsZero() || f.RuleID == alert.RuleID) &&
+		(f.State == "" || f.State == alert.State)
+}
+
+// AlertStore keeps alert rules and the alerts they raise. Rule methods
+// return ErrNotFound when the rule does not exist. Alerts are kept when
+// their rule is deleted.
+type AlertStore interface {
+	CreateRule(ctx context.Context, rule models.AlertRule) (primitive.ObjectID, error)
+	GetRule(ctx context.Context, id primitive.ObjectID) (models.AlertRule, error)
+	UpdateRule(ctx context.Context, id primitive.ObjectID, rule models.AlertRule) (models.AlertRule, error)
+	DeleteRule(ctx context.Context, id primitive.ObjectID) error
+	ListRules(ctx context.Context) ([]models.AlertRule, error)
+
+	AddAlert(ctx context.Context, alert models.Alert) (primitive.ObjectID, error)
+	// QueryAlerts returns matching alerts by the time of their reading
+	QueryAlerts(ctx context.Context, filter AlertFilter, query RangeQuery) ([]models.Alert, error)
+	// LatestAlert returns the alert of a rule on a buoy with the latest
+	// reading time, or ErrNotFound
+	LatestAlert(ctx context.Context, ruleID, buoyID primitive.ObjectID) (models.Alert, error)
+}
+
+// WebhookStore keeps webhook subscriptions and the events they failed to
+// take. Methods return ErrNotFound when the webhook or dead letter does not
+// exist. Deleting a webhook deletes its dead letters.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook models.Webhook) (primitive.ObjectID, error)
+	GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id primitive.ObjectID, webhook models.Webhook) (models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id primitive.ObjectID) error
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+
+	AddDeadLetter(ctx context.Context, letter models.DeadLetter) (primitive.ObjectID, error)
+	GetDeadLetter(ctx context.Context, id primitive.ObjectID) (models.DeadLetter, error)
+	// ListDeadLetters returns a webhook's dead letters, oldest first
+	ListDeadLetters(ctx context.Context, webhookID primitive.ObjectID) ([]models.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error
+}
+
+// StatusEventFilter selects status events by buoy and new status. Zero
+// fields match any event.
+type StatusEventFilter struct {
+	BuoyID primitive.ObjectID
+	Status string
+}
+
+func (f StatusEventFilter) matches(event models.StatusEvent) bool {
+	return (f.BuoyID.IsZero() || f.BuoyID == event.BuoyID) &&
+		(f.Status == "" || f.Status == event.Status)
+}
+
+// StatusStore keeps the changes of buoys' reporting status. Events are kept
+// when their buoy is deleted.
+type StatusStore interface {
+	AddStatusEvent(ctx context.Context, event models.StatusEvent) (primitive.ObjectID, error)
+	// QueryStatusEvents returns matching events by the time they were noticed
+	QueryStatusEvents(ctx context.Context, filter StatusEventFilter, query RangeQuery) ([]models.StatusEvent, error)
+	// LatestStatusEvent returns the latest event of a buoy, or ErrNotFound
+	LatestStatusEvent(ctx context.Context, buoyID primitive.ObjectID) (models.StatusEvent, error)
+}
+
+// DriftEventFilter selects drift events by buoy and state. Zero fields
+// match any event.
+type DriftEventFilter struct {
+	BuoyID primitive.ObjectID
+	State  string
+}
+
+func (f DriftEventFilter) matches(event models.DriftEvent) bool {
+	return (f.BuoyID.IsZero() || f.BuoyID == event.BuoyID) &&
+		(f.State == "" || f.State == event.State)
+}
+
+// DriftStore keeps the times buoys left or came back into their watch
+// circle. Events are kept when their buoy is deleted.
+type DriftStore interface {
+	AddDriftEvent(ctx context.Context, event models.DriftEvent) (primitive.ObjectID, error)
+	// QueryDriftEvents returns matching events by the time of their fix
+	QueryDriftEvents(ctx context.Context, filter DriftEventFilter, query RangeQuery) ([]models.DriftEvent, error)
+	// LatestDriftEvent returns the event of a buoy with the latest fix, or
+	// ErrNotFound
+	LatestDriftEvent(ctx context.Context, buoyID primitive.ObjectID) (models.DriftEvent, error)
+}
+
+// Latest of a non-empty set of readings
+func latestWaves(waves []models.WavesData) models.WavesData {
+	latest := waves[0]
+	for _, w := range waves[1:] {
+		if w.Timestamp.After(latest.Timestamp.Time) {
+			latest = w
+		}
+	}
+	return latest
+}
+
+// Move a buoy's last known position to the latest of some readings, unless
+// the buoy already has a newer position
+func advancePosition(buoy *models.Buoy, waves []models.WavesData) {
+	latest := latestWaves(waves)
+	if buoy.PositionTime != nil && latest.Timestamp.Before(buoy.PositionTime.Time) {
+		return
+	}
+	timestamp := latest.Timestamp
+	buoy.Position = models.NewGeoPoint(latest.Latitude, latest.Longitude)
+	buoy.PositionTime = &timestamp
+}
+
+// Buoys within radiusKm of a point, closest first, for backends without a
+// geospatial index
+func nearbyBuoys(buoys []models.Buoy, lat, lon, radiusKm float64) []NearbyBuoy {
+	nearby := []NearbyBuoy{}
+	for _, buoy := range buoys {
+		if buoy.Position == nil {
+			continue
+		}
+		distance := geo.DistanceKm(lat, lon, buoy.Position.Coordinates[1], buoy.Position.Coordinates[0])
+		if distance <= radiusKm {
+			nearby = append(nearby, NearbyBuoy{Buoy: buoy, DistanceKm: distance})
+		}
+	}
+	sort.Slice(nearby, func(i, j int) bool { return nearby[i].DistanceKm < nearby[j].DistanceKm })
+	return nearby
+}
+
+func waveKey(o models.WaveObservation) RangeCursor {
+	return RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+}
+
+func spectrumKey(o models.SpectrumObservation) RangeCursor {
+	return RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+}
+
+func observationKey(o models.PayloadObservation) RangeCursor {
+	return RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+}
+
+func alertKey(a models.Alert) RangeCursor {
+	return RangeCursor{Timestamp: a.Timestamp.Time, ID: a.ID}
+}
+
+func statusEventKey(e models.StatusEvent) RangeCursor {
+	return RangeCursor{Timestamp: e.Timestamp.Time, ID: e.ID}
+}
+
+func driftEventKey(e models.DriftEvent) RangeCursor {
+	return RangeCursor{Timestamp: e.Timestamp.Time, ID: e.ID}
+}
+
+func telemetryKey(o models.TelemetryObservation) RangeCursor {
+	return RangeCursor{Timestamp: o.Timestamp.Time, ID: o.ID}
+}
+
+// Latest of a non-empty set of telemetry records
+func latestTelemetry(records []models.TelemetryRecord) models.TelemetryRecord {
+	latest := records[0]
+	for _, r := range records[1:] {
+		if r.Timestamp.After(latest.Timestamp.Time) {
+			latest = r
+		}
+	}
+	return latest
+}
+
+// Move a buoy's telemetry snapshot to the latest of some records, unless the
+// buoy already has a newer snapshot. Values missing from the record are kept.
+func advanceTelemetry(buoy *models.Buoy, records []models.TelemetryRecord) {
+	latest := latestTelemetry(records)
+	if buoy.TelemetryTime != nil && latest.Timestamp.Before(buoy.TelemetryTime.Time) {
+		return
+	}
+	if latest.BatteryVoltage != nil {
+		buoy.BatteryVoltage = *latest.BatteryVoltage
+	}
+	if latest.BatteryPower != nil {
+		buoy.BatteryPower = *latest.BatteryPower
+	}
+	if latest.SolarVoltage != nil {
+		buoy.SolarVoltage = *latest.SolarVoltage
+	}
+	if latest.Humidity != nil {
+		buoy.Humidity = *latest.Humidity
+	}
+	timestamp := latest.Timestamp
+	buoy.TelemetryTime = &timestamp
+}
+
+// Move a buoy's last report time forward to a reading's time
+func advanceLastReport(buoy *models.Buoy, timestamp models.Timestamp) {
+	if buoy.LastReportTime != nil && !timestamp.After(buoy.LastReportTime.Time) {
+		return
+	}
+	buoy.LastReportTime = &timestamp
+}
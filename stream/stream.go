@@ -0,0 +1,174 @@
+// Package stream fans the readings stored for buoys out to clients watching
+// them live. Each event gets an increasing ID, and the latest events are kept
+// so a client that reconnects can resume where it left off.
+package stream
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// Event types
+const (
+	TypeWaves     = "waves"
+	TypeTelemetry = "telemetry"
+)
+
+// Events a subscriber may fall behind by before it is dropped
+const subscriberBuffer = 256
+
+// Event is a newly stored reading. Data is a models.WavesData or a
+// models.TelemetryRecord, depending on Type.
+type Event struct {
+	ID     uint64             `json:"id"`
+	Type   string             `json:"type"`
+	BuoyID primitive.ObjectID `json:"buoyId"`
+	Data   interface{}        `json:"data"`
+}
+
+// Hub publishes events to subscribers and keeps the latest of them.
+// IDs start over when the server restarts.
+type Hub struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub returns a hub keeping the latest historySize events
+func NewHub(historySize int) *Hub {
+	if historySize < 0 {
+		historySize = 0
+	}
+	return &Hub{
+		historySize: historySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events of one buoy, or of every buoy
+type Subscription struct {
+	hub    *Hub
+	buoyID primitive.ObjectID
+	events chan Event
+}
+
+// Events delivers the subscription's events. It is closed when the
+// subscription is closed, or dropped for falling behind; the client can
+// then resume from the last event it got.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func (s *Subscription) matches(e Event) bool {
+	return s.buoyID.IsZero() || s.buoyID == e.BuoyID
+}
+
+// Must be called with the hub locked
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Subscribe to the events of a buoy, or of every buoy if buoyID is zero. If
+// lastEventID is set, the kept events after it are returned to be sent
+// first. When that ID is no longer kept, or is unknown because the server
+// restarted, every kept event is returned.
+func (h *Hub) Subscribe(buoyID primitive.ObjectID, lastEventID *uint64) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &Subscription{hub: h, buoyID: buoyID, events: make(chan Event, subscriberBuffer)}
+	h.subscribers[s] = struct{}{}
+	if lastEventID == nil {
+		return s, nil
+	}
+
+	after := *lastEventID
+	if after > h.lastID {
+		after = 0
+	}
+	var backlog []Event
+	for _, e := range h.history {
+		if e.ID > after && s.matches(e) {
+			backlog = append(backlog, e)
+		}
+	}
+	return s, backlog
+}
+
+// Publish sends an event to the subscribers watching its buoy. Subscribers
+// whose buffer is full are dropped rather than holding up ingestion.
+func (h *Hub) Publish(buoyID primitive.ObjectID, eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e := Event{ID: h.lastID, Type: eventType, BuoyID: buoyID, Data: data}
+	h.history = append(h.history, e)
+	if len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+
+	for s := range h.subscribers {
+		if !s.matches(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Store wraps a BuoyStore so that the waves readings and telemetry records
+// it stores are published to the hub's subscribers
+func (h *Hub) Store(buoys storage.BuoyStore) storage.BuoyStore {
+	return &publishingStore{BuoyStore: buoys, hub: h}
+}
+
+type publishingStore struct {
+	storage.BuoyStore
+	hub *Hub
+}
+
+func (s *publishingStore) AddWaves(ctx context.Context, id primitive.ObjectID, waves ...models.WavesData) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddWaves(ctx, id, waves...)
+	if err != nil {
+		return duplicate, err
+	}
+	for i, w := range waves {
+		if !duplicate[i] {
+			s.hub.Publish(id, TypeWaves, w)
+		}
+	}
+	return duplicate, nil
+}
+
+func (s *publishingStore) AddTelemetry(ctx context.Context, id primitive.ObjectID, records ...models.TelemetryRecord) ([]bool, error) {
+	duplicate, err := s.BuoyStore.AddTelemetry(ctx, id, records...)
+	if err != nil {
+		return duplicate, err
+	}
+	for i, r := range records {
+		if !duplicate[i] {
+			s.hub.Publish(id, TypeTelemetry, r)
+		}
+	}
+	return duplicate, nil
+}
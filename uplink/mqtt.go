@@ -0,0 +1,355 @@
+// Package uplink receives readings that buoys publish over MQTT, for buoys
+// on cellular links that do not call the HTTP API.
+package uplink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"od-api/models"
+	"od-api/storage"
+)
+
+const (
+	// Placeholder of the buoy ID in topic patterns
+	BuoyIDPlaceholder = "{buoyId}"
+
+	// Messages waiting to be stored. Further messages are dropped, so a
+	// slow store cannot stall the client's network loop.
+	queueSize = 1024
+)
+
+var (
+	ErrInvalidPattern = errors.New("uplink: topic pattern needs " + BuoyIDPlaceholder + " as a whole level and no wildcards")
+	// Wrapped by the errors a Sink returns for readings that can never be
+	// stored, as opposed to failures of the store
+	ErrInvalidReading = errors.New("invalid reading")
+)
+
+// Sink stores the waves readings of a buoy from one message, and returns
+// the outcome of each: nil if it was stored or already stored
+type Sink func(buoyID string, waves []models.WavesData) []error
+
+// Config of the MQTT subscriber
+type Config struct {
+	// Broker URL such as tcp://localhost:1883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Topic pattern such as od/buoys/{buoyId}/waves
+	Topic string
+	QoS   byte
+	// Delay before the first reconnect attempt, doubled after each failed
+	// one up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// TopicMetrics counts the messages received on a topic
+type TopicMetrics struct {
+	Messages int `json:"messages"`
+	// Readings stored, or already stored
+	Readings int `json:"readings"`
+	// Messages or readings that could not be decoded or were invalid
+	Rejected int `json:"rejected"`
+	// Readings of buoys that do not exist
+	UnknownBuoy int `json:"unknownBuoy"`
+	// Readings the store failed to write
+	Failed int `json:"failed"`
+	// Messages dropped because too many were waiting to be stored
+	Dropped     int        `json:"dropped"`
+	LastMessage *time.Time `json:"lastMessage,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// Status is a snapshot of the subscriber's state
+type Status struct {
+	Broker     string                  `json:"broker"`
+	Topic      string                  `json:"topic"`
+	Connected  bool                    `json:"connected"`
+	Reconnects int                     `json:"reconnects"`
+	LastError  string                  `json:"lastError,omitempty"`
+	Topics     map[string]TopicMetrics `json:"topics"`
+}
+
+// Subscriber subscribes to the waves topics of buoys and stores what they
+// publish
+type Subscriber struct {
+	config Config
+	sink   Sink
+	filter string
+	// Level of the topic holding the buoy ID
+	idLevel int
+	levels  []string
+
+	mu         sync.Mutex
+	connected  bool
+	reconnects int
+	lastError  string
+	topics     map[string]*TopicMetrics
+
+	queue chan message
+}
+
+// A message waiting to be stored
+type message struct {
+	topic   string
+	payload []byte
+	metrics *TopicMetrics
+}
+
+// NewSubscriber checks the topic pattern and fills in default backoffs
+func NewSubscriber(config Config, sink Sink) (*Subscriber, error) {
+	levels := strings.Split(config.Topic, "/")
+	idLevel := -1
+	for i, level := range levels {
+		switch {
+		case level == BuoyIDPlaceholder && idLevel < 0:
+			idLevel = i
+		case strings.ContainsAny(level, "+#{}"):
+			return nil, ErrInvalidPattern
+		}
+	}
+	if idLevel < 0 {
+		return nil, ErrInvalidPattern
+	}
+
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = 2 * time.Minute
+	}
+	if config.ClientID == "" {
+		config.ClientID = fmt.Sprintf("od-api-%d", rand.Int63())
+	}
+
+	filter := make([]string, len(levels))
+	copy(filter, levels)
+	filter[idLevel] = "+"
+
+	return &Subscriber{
+		config:  config,
+		sink:    sink,
+		filter:  strings.Join(filter, "/"),
+		idLevel: idLevel,
+		levels:  levels,
+		topics:  make(map[string]*TopicMetrics),
+		queue:   make(chan message, queueSize),
+	}, nil
+}
+
+// Run connects to the broker and handles messages until ctx is done. When
+// the connection fails or is lost it reconnects with exponential backoff.
+func (s *Subscriber) Run(ctx context.Context) {
+	go s.work(ctx)
+
+	lost := make(chan error, 1)
+	opts := mqtt.NewClientOptions().
+		AddBroker(s.config.Broker).
+		SetClientID(s.config.ClientID).
+		SetUsername(s.config.Username).
+		SetPassword(s.config.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectTimeout(10 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			select {
+			case lost <- err:
+			default:
+			}
+		})
+	client := mqtt.NewClient(opts)
+
+	backoff := s.config.MinBackoff
+	for {
+		err := s.connect(client)
+		if err == nil {
+			backoff = s.config.MinBackoff
+			log.Println("uplink: subscribed to", s.filter, "on", s.config.Broker)
+			select {
+			case <-ctx.Done():
+				client.Disconnect(250)
+				s.setConnected(false, nil)
+				return
+			case err = <-lost:
+			}
+		}
+
+		s.setConnected(false, err)
+		// Jitter keeps a fleet of servers from reconnecting in step
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		log.Println("uplink: connection to", s.config.Broker, "failed:", err, "- retrying in", wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		backoff *= 2
+		if backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+
+		s.mu.Lock()
+		s.reconnects++
+		s.mu.Unlock()
+	}
+}
+
+// Connect and subscribe. A clean session drops subscriptions, so they are
+// made again on every connection.
+func (s *Subscriber) connect(client mqtt.Client) error {
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	if token := client.Subscribe(s.filter, s.config.QoS, s.handle); token.Wait() && token.Error() != nil {
+		client.Disconnect(0)
+		return token.Error()
+	}
+	s.setConnected(true, nil)
+	return nil
+}
+
+func (s *Subscriber) setConnected(connected bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = connected
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+// Extract the buoy ID from a topic matching the pattern
+func (s *Subscriber) buoyID(topic string) (string, bool) {
+	levels := strings.Split(topic, "/")
+	if len(levels) != len(s.levels) {
+		return "", false
+	}
+	for i, level := range levels {
+		if i != s.idLevel && level != s.levels[i] {
+			return "", false
+		}
+	}
+	return levels[s.idLevel], levels[s.idLevel] != ""
+}
+
+// Decode a message holding a waves reading or a JSON array of them
+func decodeWaves(payload []byte) ([]models.WavesData, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) > 0 && payload[0] == '[' {
+		var waves []models.WavesData
+		err := json.Unmarshal(payload, &waves)
+		return waves, err
+	}
+	var w models.WavesData
+	if err := json.Unmarshal(payload, &w); err != nil {
+		return nil, err
+	}
+	return []models.WavesData{w}, nil
+}
+
+// Count a message and queue it for the worker, without blocking the
+// client's network loop
+func (s *Subscriber) handle(_ mqtt.Client, m mqtt.Message) {
+	topic := m.Topic()
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metrics, ok := s.topics[topic]
+	if !ok {
+		metrics = &TopicMetrics{}
+		s.topics[topic] = metrics
+	}
+	metrics.Messages++
+	metrics.LastMessage = &now
+
+	select {
+	case s.queue <- message{topic: topic, payload: m.Payload(), metrics: metrics}:
+	default:
+		metrics.Dropped++
+		metrics.LastError = "message dropped, too many waiting to be stored"
+	}
+}
+
+// Store queued messages until ctx is done
+func (s *Subscriber) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-s.queue:
+			s.store(m)
+		}
+	}
+}
+
+// Decode a message and store its readings in one call to the sink
+func (s *Subscriber) store(m message) {
+	metrics := m.metrics
+	buoyID, ok := s.buoyID(m.topic)
+	var waves []models.WavesData
+	err := fmt.Errorf("topic %s does not match %s", m.topic, s.config.Topic)
+	if ok {
+		waves, err = decodeWaves(m.payload)
+	}
+	if err != nil {
+		s.mu.Lock()
+		metrics.Rejected++
+		metrics.LastError = err.Error()
+		s.mu.Unlock()
+		return
+	}
+	if len(waves) == 0 {
+		return
+	}
+
+	errs := s.sink(buoyID, waves)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			metrics.Readings++
+		case errors.Is(err, storage.ErrNotFound):
+			metrics.UnknownBuoy++
+		case errors.Is(err, ErrInvalidReading):
+			metrics.Rejected++
+		default:
+			metrics.Failed++
+		}
+		if err != nil {
+			metrics.LastError = err.Error()
+		}
+	}
+}
+
+// Status returns the connection state and the metrics of each topic
+func (s *Subscriber) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	topics := make(map[string]TopicMetrics, len(s.topics))
+	for topic, metrics := range s.topics {
+		topics[topic] = *metrics
+	}
+	return Status{
+		Broker:     s.config.Broker,
+		Topic:      s.config.Topic,
+		Connected:  s.connected,
+		Reconnects: s.reconnects,
+		LastError:  s.lastError,
+		Topics:     topics,
+	}
+}
@@ -0,0 +1,106 @@
+package uplink
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"od-api/models"
+)
+
+// Broker of the tests, set with MQTT_TEST_BROKER. The tests are skipped
+// when it cannot be reached.
+func testBroker(t *testing.T) (mqtt.Client, string) {
+	broker := os.Getenv("MQTT_TEST_BROKER")
+	if broker == "" {
+		broker = "tcp://localhost:1883"
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(fmt.Sprintf("od-api-test-%d", rand.Int63())).
+		SetConnectTimeout(2 * time.Second)
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Skipf("no MQTT broker at %s: %v", broker, token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(250) })
+	return client, broker
+}
+
+// Poll until ok returns true, or fail after a few seconds
+func eventually(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSubscriberStoresEachMessageInOneCall(t *testing.T) {
+	publisher, broker := testBroker(t)
+
+	var mu sync.Mutex
+	var calls [][]models.WavesData
+	sink := func(buoyID string, waves []models.WavesData) []error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, waves)
+		errs := make([]error, len(waves))
+		for i, w := range waves {
+			if w.Timestamp.IsZero() {
+				errs[i] = fmt.Errorf("%w: no timestamp", ErrInvalidReading)
+			}
+		}
+		return errs
+	}
+
+	prefix := fmt.Sprintf("od-api-test/%d", rand.Int63())
+	subscriber, err := NewSubscriber(Config{
+		Broker: broker,
+		Topic:  prefix + "/" + BuoyIDPlaceholder + "/waves",
+		QoS:    1,
+	}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go subscriber.Run(ctx)
+	eventually(t, "the subscription", func() bool { return subscriber.Status().Connected })
+
+	topic := prefix + "/64c1de1bccc77c103ab51ed1/waves"
+	messages := []string{
+		`{"significantWaveHeight": 1.14, "timestamp": "2023-08-01T10:30:00Z", "latitude": 34.30115, "longitude": -120.6133}`,
+		`[{"significantWaveHeight": 1.2, "timestamp": "2023-08-01T11:00:00Z", "latitude": 34.3, "longitude": -120.61},
+		  {"significantWaveHeight": 1.3, "latitude": 34.3, "longitude": -120.61}]`,
+		`{"significantWaveHeight":`,
+	}
+	for _, m := range messages {
+		if token := publisher.Publish(topic, 1, false, m); token.Wait() && token.Error() != nil {
+			t.Fatal(token.Error())
+		}
+	}
+
+	eventually(t, "the messages", func() bool {
+		metrics := subscriber.Status().Topics[topic]
+		return metrics.Readings+metrics.Rejected == 4
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 || len(calls[0]) != 1 || len(calls[1]) != 2 {
+		t.Fatalf("sink calls = %v, want one of 1 reading and one of 2", calls)
+	}
+	metrics := subscriber.Status().Topics[topic]
+	if metrics.Messages != 3 || metrics.Readings != 2 || metrics.Rejected != 2 || metrics.Dropped != 0 {
+		t.Errorf("metrics = %+v, want 3 messages, 2 readings and 2 rejected", metrics)
+	}
+}
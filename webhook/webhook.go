@@ -0,0 +1,462 @@
+// Package webhook tells downstream systems about events such as new alerts
+// by POSTing them to subscribed URLs. Deliveries run in the background and
+// are retried with exponential backoff; events a webhook still fails to
+// take are kept as dead letters.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"od-api/models"
+	"od-api/storage"
+)
+
+// Event types
+const (
+	EventAlertFiring  = "alert.firing"
+	EventAlertCleared = "alert.cleared"
+	EventBuoyCreated  = "buoy.created"
+	EventBuoyDeleted  = "buoy.deleted"
+	EventBuoyOnline   = "buoy.online"
+	EventBuoyLate     = "buoy.late"
+	EventBuoyOffline  = "buoy.offline"
+	EventBuoyAdrift   = "buoy.adrift"
+	EventBuoyReturned = "buoy.returned"
+)
+
+// EventTypes lists the event types webhooks can subscribe to
+var EventTypes = []string{EventAlertFiring, EventAlertCleared, EventBuoyCreated, EventBuoyDeleted, EventBuoyOnline, EventBuoyLate, EventBuoyOffline, EventBuoyAdrift, EventBuoyReturned}
+
+// Request headers of a delivery
+const (
+	HeaderEvent     = "X-OD-Event"
+	HeaderDelivery  = "X-OD-Delivery"
+	HeaderTimestamp = "X-OD-Timestamp"
+	HeaderSignature = "X-OD-Signature"
+)
+
+const (
+	workers   = 4
+	queueSize = 1000
+	// Deliveries that found the queue full, waiting to be kept as dead
+	// letters. Further ones are dropped.
+	letterQueueSize = 1000
+	maxAttempts     = 8
+	minBackoff      = time.Second
+	maxBackoff      = 5 * time.Minute
+	// Time a webhook has to answer
+	deliveryTimeout = 10 * time.Second
+)
+
+var errQueueFull = errors.New("delivery queue full")
+
+var ErrUnknownEvent = errors.New("unknown event type, expected one of " + strings.Join(EventTypes, ", ") + ", a prefix such as alert.* or *")
+
+// CheckEvents validates the event types of a subscription, which may end
+// in .* to match a prefix, or be * to match every event
+func CheckEvents(events []string) error {
+	for _, pattern := range events {
+		known := pattern == "*"
+		for _, event := range EventTypes {
+			if matches(pattern, event) {
+				known = true
+			}
+		}
+		if !known {
+			return ErrUnknownEvent
+		}
+	}
+	return nil
+}
+
+func matches(pattern, event string) bool {
+	if pattern == "*" || pattern == event {
+		return true
+	}
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event, strings.TrimSuffix(pattern, "*"))
+}
+
+func subscribed(webhook models.Webhook, event string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, pattern := range webhook.Events {
+		if matches(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the body POSTed to webhooks. Exercise is set on events raised by
+// synthetic readings, such as those of a drill.
+type Event struct {
+	ID        primitive.ObjectID `json:"id"`
+	Type      string             `json:"type"`
+	CreatedAt models.Timestamp   `json:"createdAt"`
+	Exercise  bool               `json:"exercise,omitempty"`
+	Data      interface{}        `json:"data"`
+}
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256, keyed by
+// the webhook's secret, of the timestamp header, a dot and the body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// An event on its way to a webhook
+type delivery struct {
+	webhookID primitive.ObjectID
+	eventID   primitive.ObjectID
+	eventType string
+	body      []byte
+	attempts  int
+}
+
+// Dispatcher delivers events to the webhooks subscribed to them. It keeps
+// the webhooks in memory. Deliveries waiting for a retry are lost when the
+// server stops.
+type Dispatcher struct {
+	webhooks storage.WebhookStore
+	client   *http.Client
+	queue    chan *delivery
+
+	mu    sync.RWMutex
+	hooks map[primitive.ObjectID]models.Webhook
+
+	// Set once Run returns, after which deliveries are dropped. Dead letters
+	// of a full queue are kept in the background and waited for by Run.
+	stopMu  sync.Mutex
+	stopped bool
+	letters chan *delivery
+	// Deliveries lost because both queues were full
+	dropped int
+}
+
+func NewDispatcher(webhooks storage.WebhookStore) *Dispatcher {
+	return &Dispatcher{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: deliveryTimeout},
+		queue:    make(chan *delivery, queueSize),
+		letters:  make(chan *delivery, letterQueueSize),
+		hooks:    make(map[primitive.ObjectID]models.Webhook),
+	}
+}
+
+// Load reads the stored webhooks
+func (d *Dispatcher) Load(ctx context.Context) error {
+	webhooks, err := d.webhooks.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, webhook := range webhooks {
+		d.hooks[webhook.ID] = webhook
+	}
+	return nil
+}
+
+// Put adds or replaces a webhook. Pending deliveries go to its new URL.
+func (d *Dispatcher) Put(webhook models.Webhook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks[webhook.ID] = webhook
+}
+
+// Remove drops a webhook and its pending deliveries
+func (d *Dispatcher) Remove(id primitive.ObjectID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.hooks, id)
+}
+
+// Run delivers events until ctx is done. It returns once the deliveries in
+// progress end and the dead letters being kept are stored; events published
+// after that are dropped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	letters := make(chan struct{})
+	go func() {
+		defer close(letters)
+		for job := range d.letters {
+			d.deadLetter(job, 0, errQueueFull)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.deliver(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	d.stopMu.Lock()
+	d.stopped = true
+	close(d.letters)
+	d.stopMu.Unlock()
+	<-letters
+}
+
+// Publish queues an event for the webhooks subscribed to it. It does not
+// wait for the deliveries.
+func (d *Dispatcher) Publish(eventType string, data interface{}, exercise bool) {
+	event := Event{
+		ID:        primitive.NewObjectID(),
+		Type:      eventType,
+		CreatedAt: models.NewTimestamp(time.Now()),
+		Exercise:  exercise,
+		Data:      data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Println("webhook: failed to encode", eventType, "event:", err)
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, webhook := range d.hooks {
+		if webhook.Disabled || !subscribed(webhook, eventType) {
+			continue
+		}
+		d.enqueue(&delivery{webhookID: webhook.ID, eventID: event.ID, eventType: eventType, body: body})
+	}
+}
+
+// Redeliver queues a dead letter again, with a fresh set of retries
+func (d *Dispatcher) Redeliver(letter models.DeadLetter) {
+	d.enqueue(&delivery{
+		webhookID: letter.WebhookID,
+		eventID:   letter.EventID,
+		eventType: letter.EventType,
+		body:      []byte(letter.Payload),
+	})
+}
+
+// Queue a delivery without blocking. When the queue is full the delivery
+// is dead-lettered rather than holding up the caller, and when too many
+// are waiting for that as well it is dropped.
+func (d *Dispatcher) enqueue(job *delivery) {
+	d.stopMu.Lock()
+	defer d.stopMu.Unlock()
+	if d.stopped {
+		return
+	}
+	select {
+	case d.queue <- job:
+		return
+	default:
+	}
+	select {
+	case d.letters <- job:
+	default:
+		d.dropped++
+		log.Println("webhook: dropped event", job.eventID.Hex(), "for webhook", job.webhookID.Hex(), "as the delivery and dead letter queues are full,", d.dropped, "dropped so far")
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, job *delivery) {
+	d.mu.RLock()
+	webhook, ok := d.hooks[job.webhookID]
+	d.mu.RUnlock()
+	if !ok || webhook.Disabled {
+		return
+	}
+
+	job.attempts++
+	status, err := d.post(ctx, webhook, job)
+	// A delivery cut short by the server stopping is lost, like those
+	// waiting for a retry
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	if job.attempts >= maxAttempts {
+		d.deadLetter(job, status, err)
+		return
+	}
+
+	backoff := minBackoff << (job.attempts - 1)
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	time.AfterFunc(backoff, func() { d.enqueue(job) })
+}
+
+// POST an event to a webhook, returning the response status
+func (d *Dispatcher) post(ctx context.Context, webhook models.Webhook, job *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "od-api-webhook")
+	req.Header.Set(HeaderEvent, job.eventType)
+	req.Header.Set(HeaderDelivery, job.eventID.Hex())
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, job.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) deadLetter(job *delivery, status int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, storeErr := d.webhooks.AddDeadLetter(ctx, models.DeadLetter{
+		WebhookID:  job.webhookID,
+		EventID:    job.eventID,
+		EventType:  job.eventType,
+		Payload:    string(job.body),
+		Attempts:   job.attempts,
+		LastStatus: status,
+		LastError:  err.Error(),
+		FailedAt:   models.NewTimestamp(time.Now()),
+	})
+	if storeErr != nil {
+		log.Println("webhook: failed to keep dead letter of event", job.eventID.Hex(), "for webhook", job.webhookID.Hex(), ":", storeErr)
+	}
+}
+
+// BuoyStore wraps a BuoyStore to publish buoy.created and buoy.deleted
+// events
+func (d *Dispatcher) BuoyStore(buoys storage.BuoyStore) storage.BuoyStore {
+	return &publishingBuoyStore{BuoyStore: buoys, dispatcher: d}
+}
+
+type publishingBuoyStore struct {
+	storage.BuoyStore
+	dispatcher *Dispatcher
+}
+
+func (s *publishingBuoyStore) CreateBuoy(ctx context.Context, buoy models.Buoy) (primitive.ObjectID, error) {
+	id, err := s.BuoyStore.CreateBuoy(ctx, buoy)
+	if err != nil {
+		return id, err
+	}
+	buoy.ID = id
+	buoy.Waves = nil
+	s.dispatcher.Publish(EventBuoyCreated, buoy, false)
+	return id, nil
+}
+
+// The event holds the deleted buoy, or only its ID if it could not be read
+// first
+func (s *publishingBuoyStore) DeleteBuoy(ctx context.Context, id primitive.ObjectID) error {
+	buoy, err := s.BuoyStore.GetBuoy(ctx, id)
+	if err != nil {
+		buoy = models.Buoy{ID: id}
+	}
+	if err := s.BuoyStore.DeleteBuoy(ctx, id); err != nil {
+		return err
+	}
+	s.dispatcher.Publish(EventBuoyDeleted, buoy, false)
+	return nil
+}
+
+// AlertStore wraps an AlertStore to publish alert.firing and alert.cleared
+// events
+func (d *Dispatcher) AlertStore(alerts storage.AlertStore) storage.AlertStore {
+	return &publishingAlertStore{AlertStore: alerts, dispatcher: d}
+}
+
+type publishingAlertStore struct {
+	storage.AlertStore
+	dispatcher *Dispatcher
+}
+
+func (s *publishingAlertStore) AddAlert(ctx context.Context, alert models.Alert) (primitive.ObjectID, error) {
+	id, err := s.AlertStore.AddAlert(ctx, alert)
+	if err != nil {
+		return id, err
+	}
+	alert.ID = id
+	eventType := EventAlertFiring
+	if alert.State == models.AlertCleared {
+		eventType = EventAlertCleared
+	}
+	s.dispatcher.Publish(eventType, alert, alert.Exercise)
+	return id, nil
+}
+
+// StatusStore wraps a StatusStore to publish buoy.online, buoy.late and
+// buoy.offline events
+func (d *Dispatcher) StatusStore(events storage.StatusStore) storage.StatusStore {
+	return &publishingStatusStore{StatusStore: events, dispatcher: d}
+}
+
+type publishingStatusStore struct {
+	storage.StatusStore
+	dispatcher *Dispatcher
+}
+
+func (s *publishingStatusStore) AddStatusEvent(ctx context.Context, event models.StatusEvent) (primitive.ObjectID, error) {
+	id, err := s.StatusStore.AddStatusEvent(ctx, event)
+	if err != nil {
+		return id, err
+	}
+	event.ID = id
+	s.dispatcher.Publish("buoy."+event.Status, event, event.Exercise)
+	return id, nil
+}
+
+// DriftStore wraps a DriftStore to publish buoy.adrift and buoy.returned
+// events
+func (d *Dispatcher) DriftStore(events storage.DriftStore) storage.DriftStore {
+	return &publishingDriftStore{DriftStore: events, dispatcher: d}
+}
+
+type publishingDriftStore struct {
+	storage.DriftStore
+	dispatcher *Dispatcher
+}
+
+func (s *publishingDriftStore) AddDriftEvent(ctx context.Context, event models.DriftEvent) (primitive.ObjectID, error) {
+	id, err := s.DriftStore.AddDriftEvent(ctx, event)
+	if err != nil {
+		return id, err
+	}
+	event.ID = id
+	s.dispatcher.Publish("buoy."+event.State, event, event.Exercise)
+	return id, nil
+}